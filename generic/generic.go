@@ -11,3 +11,30 @@ type Type interface{}
 // references to the specific types.
 //      var GenericType generic.Number
 type Number float64
+
+// String is the placeholder type that indicates a generic string value.
+// When genny is executed, variables of this type will be replaced with
+// references to the specific types, which must be string types.
+//      var GenericType generic.String
+type String string
+
+// Ordered is the placeholder type that indicates a generic value that can
+// be compared with < and friends.
+// When genny is executed, variables of this type will be replaced with
+// references to the specific types, which must be numbers or strings.
+//      var GenericType generic.Ordered
+type Ordered float64
+
+// Size is the placeholder constant that indicates a generic array length.
+// When genny is executed, constants set to it will be replaced with the
+// specific lengths, which must be integer literals.
+//      const GenericSize = generic.Size
+const Size = 1
+
+// Zero is the placeholder for the zero value of a generic type.
+// When genny is executed, conversions of it to a generic type will be
+// replaced with the zero value of the specific type, like 0, "", nil or
+// T{} (or *new(T) if it depends on what T is).
+// It is a rune so that it can be converted to any of the placeholder types.
+//      return GenericType(generic.Zero)
+const Zero rune = 0
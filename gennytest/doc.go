@@ -0,0 +1,3 @@
+// Package gennytest helps test genny templates, by comparing the code
+// they generate with golden files.
+package gennytest
@@ -0,0 +1,81 @@
+package gennytest
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/joelrahman/genny/parse"
+)
+
+// update saves the generated code to the golden files instead of
+// comparing it with them.
+var update = flag.Bool("genny.update", false, "save the code generated by gennytest.AssertGenerates to the golden files instead of comparing them")
+
+// AssertGenerates asserts that the template at templatePath generates the
+// code in the golden file at goldenPath for the type sets, and gets
+// whether it does. The generated code keeps the package of the template.
+//
+// Running the test with -genny.update saves the generated code to the
+// golden file instead, making it if need be.
+//
+//	func TestQueue(t *testing.T) {
+//		gennytest.AssertGenerates(t, "generic_queue.go", []map[string]string{{"Item": "int"}}, "testdata/int_queue.go")
+//	}
+func AssertGenerates(t testing.TB, templatePath string, typeSets []map[string]string, goldenPath string) bool {
+	t.Helper()
+	in, err := os.Open(templatePath)
+	if err != nil {
+		t.Errorf("%v", err)
+		return false
+	}
+	defer in.Close()
+	got, err := parse.Generics(templatePath, "", in, typeSets, "")
+	if err != nil {
+		t.Errorf("%s: %v", templatePath, err)
+		return false
+	}
+
+	if *update {
+		if err := ioutil.WriteFile(goldenPath, got, 0644); err != nil {
+			t.Errorf("%v", err)
+			return false
+		}
+		return true
+	}
+
+	want, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Errorf("%v (run the test with -genny.update to make it)", err)
+		return false
+	}
+	if n, gotLine, wantLine, differ := firstDifference(got, want); differ {
+		t.Errorf("%s generates different code to %s from line %d:\n got: %q\nwant: %q\n(run the test with -genny.update to update it)", templatePath, goldenPath, n, gotLine, wantLine)
+		return false
+	}
+	return true
+}
+
+// firstDifference gets the number of the first line that differs between
+// the generated code and the golden file, and the lines themselves. The
+// lines are empty past the end of the code they are from.
+func firstDifference(got, want []byte) (int, string, string, bool) {
+	if bytes.Equal(got, want) {
+		return 0, "", "", false
+	}
+	gotLines, wantLines := bytes.Split(got, []byte("\n")), bytes.Split(want, []byte("\n"))
+	for i := 0; ; i++ {
+		var g, w []byte
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if !bytes.Equal(g, w) || i >= len(gotLines) || i >= len(wantLines) {
+			return i + 1, string(g), string(w), true
+		}
+	}
+}
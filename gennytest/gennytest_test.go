@@ -0,0 +1,65 @@
+package gennytest_test
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joelrahman/genny/gennytest"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder records the errors of a test instead of failing it.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertGenerates(t *testing.T) {
+
+	template := "../parse/test/queue/generic_queue.go"
+	typeSets := []map[string]string{{"Something": "int"}}
+
+	r := &recorder{TB: t}
+	assert.True(t, gennytest.AssertGenerates(r, template, typeSets, "../parse/test/queue/int_queue.go"))
+	assert.Empty(t, r.errors)
+
+	r = &recorder{TB: t}
+	assert.False(t, gennytest.AssertGenerates(r, template, typeSets, "../parse/test/queue/float32_queue.go"))
+	if assert.Len(t, r.errors, 1) {
+		assert.Contains(t, r.errors[0], "generic_queue.go generates different code to ../parse/test/queue/float32_queue.go from line 7:\n got: \"// IntQueue")
+	}
+
+	dir, err := ioutil.TempDir("", "gennytest")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	golden := filepath.Join(dir, "int_queue.go")
+
+	r = &recorder{TB: t}
+	assert.False(t, gennytest.AssertGenerates(r, template, typeSets, golden))
+	if assert.Len(t, r.errors, 1) {
+		assert.Contains(t, r.errors[0], "run the test with -genny.update to make it")
+	}
+
+	// -genny.update saves the golden file
+	assert.NoError(t, flag.Set("genny.update", "true"))
+	defer flag.Set("genny.update", "false")
+	r = &recorder{TB: t}
+	assert.True(t, gennytest.AssertGenerates(r, template, typeSets, golden))
+	assert.Empty(t, r.errors)
+	want, _ := ioutil.ReadFile("../parse/test/queue/int_queue.go")
+	got, _ := ioutil.ReadFile(golden)
+	assert.Equal(t, string(want), string(got))
+
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/joelrahman/genny/parse"
+)
+
+// templateSuffix ends the names of templates generated in a batch, which
+// are generated into a file without it (foo.genny.go into foo.go).
+// Templates of tests end with testTemplateSuffix instead (or are named
+// foo_test.genny.go).
+const (
+	templateSuffix     = ".genny.go"
+	testTemplateSuffix = ".genny_test.go"
+)
+
+// isGlob gets whether the name is a pattern for more than one file.
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// globFiles gets the files matching the pattern, which can use ** to
+// match any number of directories as well as the syntax of
+// filepath.Match.
+func globFiles(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	// walk from the deepest directory without a wildcard
+	elems := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	var root []string
+	for _, elem := range elems {
+		if isGlob(elem) {
+			break
+		}
+		root = append(root, elem)
+	}
+	dir := "."
+	if len(root) > 0 {
+		dir = filepath.FromSlash(strings.Join(root, "/"))
+	}
+
+	var matches []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && matchElems(elems, strings.Split(filepath.ToSlash(path), "/")) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// matchElems gets whether the elements of a path match those of a
+// pattern, where a ** element matches any number of elements.
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// batchOutput gets the name of the file to generate from a template in a
+// batch, which is the name of the template without .genny.
+func batchOutput(filename string) (string, error) {
+	if strings.HasSuffix(filename, testTemplateSuffix) {
+		return strings.TrimSuffix(filename, testTemplateSuffix) + "_test.go", nil
+	}
+	if !strings.HasSuffix(filename, templateSuffix) {
+		return "", fmt.Errorf("%s: can't tell what to name the generated file (name the template like foo%s or use -out-pattern)", filename, templateSuffix)
+	}
+	return strings.TrimSuffix(filename, templateSuffix) + ".go", nil
+}
+
+// genBatch generates the code for each of the files, printing the error
+// for any that fail and carrying on with the rest (unless failFast is
+// set). It gets how many of the files were generated and how many failed.
+func genBatch(files []string, run func(filename string, in io.ReadSeeker, out string) error, outPattern bool, failFast bool) (int, int) {
+	generated, failed := 0, 0
+	for _, filename := range files {
+		err := genBatchFile(filename, run, outPattern)
+		if err == nil {
+			generated++
+			continue
+		}
+		fmt.Fprintln(os.Stderr, err)
+		failed++
+		if failFast {
+			break
+		}
+	}
+	return generated, failed
+}
+
+// genBatchFile generates the code for one file of a batch.
+func genBatchFile(filename string, run func(filename string, in io.ReadSeeker, out string) error, outPattern bool) error {
+	var out string
+	if !outPattern {
+		var err error
+		if out, err = batchOutput(filename); err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = run(filename, f, out)
+	if err == nil {
+		return nil
+	}
+
+	// errors about a position in the template name it already
+	var perr parse.PositionError
+	if errors.As(err, &perr) {
+		if pos := perr.Pos(); pos.IsValid() {
+			return err
+		}
+	}
+	return fmt.Errorf("%s: %v", filename, err)
+}
+
+// checkBatchTypes makes sure every generic type of the type sets is
+// declared by at least one of the templates of a batch, which are each
+// generated for just the generic types they declare. Templates that
+// can't be read are left to fail when they are generated.
+func checkBatchTypes(files []string, typeSets []map[string]string, opts parse.Options) error {
+	declared := make(map[string]bool)
+	for _, filename := range files {
+		f, err := os.Open(filename)
+		if err != nil {
+			continue
+		}
+		params, err := parse.GenericTypesWithOptions(filename, f, opts)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		for _, p := range params {
+			declared[p.Name] = true
+		}
+	}
+	var unknown []string
+	for _, typeSet := range typeSets {
+		for t := range typeSet {
+			// C types can take their specific type from a Go type
+			if !declared[t] && !declared["C"+t] && !containsString(unknown, t) {
+				unknown = append(unknown, t)
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("none of the %d templates declare the generic type %s", len(files), strings.Join(unknown, ", "))
+}
+
+// containsString gets whether the strings include s.
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// generatedMarker is in the header of code generated by genny.
+var generatedMarker = []byte("This file was automatically generated by genny.")
+
+// defaultGenericImport is the import path of genny's generic package.
+const defaultGenericImport = "github.com/joelrahman/genny/generic"
+
+// findTemplates walks the directory, and those below it, for the Go files
+// that import the generic package at importPath (or genny's, if it is
+// empty). Vendor, testdata and hidden directories are skipped, as are
+// files genny generated and tests other than templates of tests (like
+// foo.genny_test.go).
+func findTemplates(root, importPath string) ([]string, error) {
+	if importPath == "" {
+		importPath = defaultGenericImport
+	}
+	root = strings.TrimSuffix(filepath.ToSlash(root), "...")
+	if root = strings.TrimSuffix(root, "/"); root == "" {
+		root = "."
+	}
+	root = filepath.FromSlash(root)
+
+	var templates []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if path != root && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") && !strings.HasSuffix(name, testTemplateSuffix) {
+			return nil
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(src, generatedMarker) && importsPackage(path, src, importPath) {
+			templates = append(templates, path)
+		}
+		return nil
+	})
+	return templates, err
+}
+
+// importsPackage gets whether the Go source imports the package at the
+// import path, or a package inside it.
+func importsPackage(filename string, src []byte, importPath string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.ImportsOnly)
+	if err != nil {
+		return false
+	}
+	for _, imp := range file.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err == nil && (path == importPath || strings.HasPrefix(path, importPath+"/")) {
+			return true
+		}
+	}
+	return false
+}
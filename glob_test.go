@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joelrahman/genny/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+// queueTemplate is a template using genny's generic package.
+const queueTemplate = `package queue
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+type ItemQueue []Item
+`
+
+// tempTree makes a temporary directory holding the files, returning it
+// and a func that removes it.
+func tempTree(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "genny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, code := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// relative gets the paths relative to the directory, with slashes.
+func relative(dir string, paths []string) []string {
+	var rel []string
+	for _, path := range paths {
+		r, _ := filepath.Rel(dir, path)
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	return rel
+}
+
+func TestFindTestTemplates(t *testing.T) {
+
+	dir, done := tempTree(t, map[string]string{
+		"queue/queue.genny_test.go": queueTemplate,
+		"queue/queue_test.go":       queueTemplate,
+	})
+	defer done()
+
+	templates, err := findTemplates(dir, "")
+	if !assert.NoError(t, err) || !assert.Equal(t, []string{"queue/queue.genny_test.go"}, relative(dir, templates)) {
+		return
+	}
+	if out, err := batchOutput(templates[0]); assert.NoError(t, err) {
+		assert.Equal(t, filepath.Join(dir, "queue", "queue_test.go"), out)
+	}
+
+}
+
+func TestMatchElems(t *testing.T) {
+
+	for _, test := range []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"a/*.genny.go", "a/queue.genny.go", true},
+		{"a/*.genny.go", "a/b/queue.genny.go", false},
+		{"**/*.genny.go", "queue.genny.go", true},
+		{"**/*.genny.go", "a/queue.genny.go", true},
+		{"**/*.genny.go", "a/b/c/queue.genny.go", true},
+		{"a/**/*.genny.go", "a/queue.genny.go", true},
+		{"a/**/*.genny.go", "a/b/queue.genny.go", true},
+		{"a/**/*.genny.go", "b/queue.genny.go", false},
+		{"a/**/b/*.go", "a/x/y/b/queue.go", true},
+		{"a/**/b/*.go", "a/x/y/c/queue.go", false},
+		{"a/**", "a/b/c", true},
+		{"**/*.genny.go", "a/queue.go", false},
+	} {
+		assert.Equal(t, test.match, matchElems(strings.Split(test.pattern, "/"), strings.Split(test.path, "/")), "%s %s", test.pattern, test.path)
+	}
+
+}
+
+func TestGlobFiles(t *testing.T) {
+
+	dir, done := tempTree(t, map[string]string{
+		"b.genny.go":          queueTemplate,
+		"a.genny.go":          queueTemplate,
+		"a.go":                queueTemplate,
+		"sub/c.genny.go":      queueTemplate,
+		"sub/deep/d.genny.go": queueTemplate,
+	})
+	defer done()
+	pattern := func(p string) string { return filepath.Join(dir, filepath.FromSlash(p)) }
+
+	for _, test := range []struct {
+		pattern string
+		files   []string
+	}{
+		{"*.genny.go", []string{"a.genny.go", "b.genny.go"}},
+		{"**/*.genny.go", []string{"a.genny.go", "b.genny.go", "sub/c.genny.go", "sub/deep/d.genny.go"}},
+		{"sub/**/*.genny.go", []string{"sub/c.genny.go", "sub/deep/d.genny.go"}},
+		{"**/deep/*.genny.go", []string{"sub/deep/d.genny.go"}},
+		{"*.missing.go", nil},
+		{"**/*.missing.go", nil},
+	} {
+		files, err := globFiles(pattern(test.pattern))
+		if assert.NoError(t, err, test.pattern) {
+			assert.Equal(t, test.files, relative(dir, files), test.pattern)
+		}
+	}
+
+}
+
+func TestFindTemplates(t *testing.T) {
+
+	generated := "// This file was automatically generated by genny.\n" + queueTemplate
+	dir, done := tempTree(t, map[string]string{
+		"queue.genny.go":          queueTemplate,
+		"other.go":                "package queue\n",
+		"int_queue.go":            generated,
+		"sub/list.go":             queueTemplate,
+		"vendor/v/queue.genny.go": queueTemplate,
+		"testdata/queue.genny.go": queueTemplate,
+		".hidden/queue.genny.go":  queueTemplate,
+		"_skipped/queue.genny.go": queueTemplate,
+		"sub/broken.go":           "package",
+		"own/queue.go":            strings.Replace(queueTemplate, "github.com/joelrahman/genny/generic", "ourco/generic", 1),
+	})
+	defer done()
+
+	templates, err := findTemplates(dir, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"queue.genny.go", "sub/list.go"}, relative(dir, templates))
+	}
+	templates, err = findTemplates(dir, "ourco/generic")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"own/queue.go"}, relative(dir, templates))
+	}
+
+	// a root ending in /... is the directory itself
+	templates, err = findTemplates(filepath.Join(dir, "sub")+"/...", "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"sub/list.go"}, relative(dir, templates))
+	}
+
+}
+
+func TestGenBatch(t *testing.T) {
+
+	dir, done := tempTree(t, map[string]string{
+		"a.genny.go": queueTemplate,
+		"b.genny.go": queueTemplate,
+		"c.genny.go": queueTemplate,
+	})
+	defer done()
+	files, err := globFiles(filepath.Join(dir, "*.genny.go"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var ran []string
+	run := func(filename string, in io.ReadSeeker, out string) error {
+		ran = append(ran, filepath.Base(filename)+">"+filepath.Base(out))
+		if filepath.Base(filename) == "b.genny.go" {
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	generated, failed := genBatch(files, run, false, false)
+	assert.Equal(t, 2, generated)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, []string{"a.genny.go>a.go", "b.genny.go>b.go", "c.genny.go>c.go"}, ran)
+
+	// -fail-fast stops at the first template that fails
+	ran = nil
+	generated, failed = genBatch(files, run, false, true)
+	assert.Equal(t, 1, generated)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, []string{"a.genny.go>a.go", "b.genny.go>b.go"}, ran)
+
+	// the errors name the template
+	err = genBatchFile(files[1], run, false)
+	if assert.Error(t, err) {
+		assert.Equal(t, files[1]+": failed", err.Error())
+	}
+
+	// unless they start with where they are in it
+	pair := strings.Replace(queueTemplate, "type Item generic.Type\n", "type Item generic.Type\ntype Other generic.Type\n", 1)
+	err = genBatchFile(files[1], func(filename string, in io.ReadSeeker, out string) error {
+		_, err := parse.Generics(filename, "", strings.NewReader(pair), []map[string]string{{"Item": "int"}}, "")
+		return err
+	}, false)
+	if assert.Error(t, err) {
+		assert.True(t, errors.Is(err, parse.ErrMissingSpecificType))
+		assert.Equal(t, files[1]+":6:6: Missing specific type for 'Other' generic type", err.Error())
+	}
+
+}
+
+func TestBatchTypeSets(t *testing.T) {
+
+	dir, done := tempTree(t, map[string]string{
+		"queue.genny.go": queueTemplate,
+		"map.genny.go":   strings.Replace(queueTemplate, "Item", "Key", -1),
+	})
+	defer done()
+	files, err := globFiles(filepath.Join(dir, "*.genny.go"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	typeSets := []map[string]string{{"Item": "int", "Key": "string"}}
+	if !assert.NoError(t, checkBatchTypes(files, typeSets, parse.Options{})) {
+		return
+	}
+	var generated []string
+	run := func(filename string, in io.ReadSeeker, out string) error {
+		code, err := gen(filename, in, typeSets, parse.Options{IgnoreUnknownGenericTypes: true}, false, false, nil)
+		generated = append(generated, string(code))
+		return err
+	}
+	if generatedN, failed := genBatch(files, run, false, false); assert.Equal(t, 0, failed) {
+		assert.Equal(t, 2, generatedN)
+		assert.Contains(t, generated[0], "type StringQueue []string")
+		assert.Contains(t, generated[1], "type IntQueue []int")
+	}
+
+	// a generic type no template declares is still a mistake
+	err = checkBatchTypes(files, []map[string]string{{"Item": "int", "Valeu": "string", "Kye": "string"}}, parse.Options{})
+	if assert.Error(t, err) {
+		assert.Equal(t, "none of the 2 templates declare the generic type Kye, Valeu", err.Error())
+	}
+
+}
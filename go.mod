@@ -1,8 +1,12 @@
 module github.com/joelrahman/genny
 
-go 1.12
+go 1.18
 
 require (
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/tools v0.0.0-20190824210100-c2567a220953
+	gopkg.in/yaml.v2 v2.2.2
 )
+
+require github.com/davecgh/go-spew v1.1.0 // indirect
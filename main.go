@@ -9,9 +9,12 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/joelrahman/genny/parse"
+	"github.com/pmezard/go-difflib/difflib"
 )
 
 /*
@@ -29,58 +32,116 @@ const (
 	exitcodeGetFailed
 	exitcodeSourceFileInvalid
 	exitcodeDestFileFailed
+	exitcodeOutOfDate
 )
 
 func main() {
 	var (
-		in      = flag.String("in", "", "file to parse instead of stdin")
-		out     = flag.String("out", "", "file to save output to instead of stdout")
-		pkgName = flag.String("pkg", "", "package name for generated files")
-		strip   = flag.String("strip", "", "prefix to strip from type names")
-		prefix  = "https://github.com/metabition/gennylib/raw/master/"
+		in         = flag.String("in", "", "file to parse instead of stdin, or a pattern like *.genny.go (or **/*.genny.go) for many files")
+		recursive  = flag.String("r", "", "generate every template in this directory and the ones below it (like ./...) instead of -in")
+		failFast   = flag.Bool("fail-fast", false, "stop at the first file that fails when -in is a pattern, instead of carrying on with the rest")
+		stdinName  = flag.String("filename", "", "path of the file read from stdin, so its imports are resolved relative to it")
+		out        = flag.String("out", "", "file to save output to instead of stdout")
+		pkgName    = flag.String("pkg", "", "package name for generated files (by default the package of the other files where -out is)")
+		strip      = flag.String("strip", "", "prefix to strip from type names")
+		generics   = flag.Bool("generics", false, "generate a single copy of the code using type parameters")
+		outPattern = flag.String("out-pattern", "", "generate a file for each type set named after this pattern, like {{.Base}}_{{.Type}}.go")
+		headerFile = flag.String("header-file", "", "file with the comment to put at the top of generated files instead of the default")
+		typesFile  = flag.String("types-file", "", "JSON or YAML file with an array of type sets to use instead of {types}")
+		diff       = flag.Bool("diff", false, "print a diff of the changes to the output files instead of writing them")
+		check      = flag.Bool("check", false, "exit with an error if the output files aren't up to date instead of writing them")
+		watchIn    = flag.Bool("watch", false, "regenerate every time the -in file changes, until stopped")
+		keepGoGen  = flag.Bool("keep-go-generate", false, "keep every //go:generate line in generated files, even the ones that run genny")
+		stripGoGen = flag.String("strip-go-generate", "", "only drop the //go:generate lines that contain this from generated files")
+		genericPkg = flag.String("generic-import", "", "import path of the package generic types are declared with, if not genny's generic package")
+		hash       = flag.Bool("hash", false, "put a hash of the template and type sets in the header, so -check and -if-newer can tell output files are up to date without generating them")
+		ifNewer    = flag.Bool("if-newer", false, "only generate output files whose template, type sets or options have changed since, like make (turns on -hash)")
+		crlf       = flag.Bool("crlf", false, "end the lines of generated files with \\r\\n instead of \\n")
+		keepDecls  = flag.Bool("keep-generic-decls", false, "keep the generic type declarations in generated files as comments, to show what they were generated from")
+		editable   = flag.Bool("editable", false, "leave the note that changes will be lost out of the default header")
+		verbose    = flag.Bool("verbose", false, "print the generic types of each type set that nothing was generated from")
+		v          = flag.Bool("v", false, "log the generic types found and each type set generated to stderr (as well as -verbose)")
+		vv         = flag.Bool("vv", false, "like -v, also logging every line generic types are replaced in")
+		local      = flag.String("local", "", "put imports beginning with this string after third-party packages, like goimports -local")
+		pkgDoc     = flag.String("package-doc", "", "package doc comment to put above the package clause of generated files, in place of the template's")
+		reportFile = flag.String("report", "", "write a JSON summary of each generated file (its package, type sets, declarations and imports) to this file")
+		prefix     = "https://github.com/metabition/gennylib/raw/master/"
 	)
 	flag.Parse()
 	args := flag.Args()
 
-	if len(args) < 2 {
+	if len(args) < 1 {
 		usage()
 		os.Exit(exitcodeInvalidArgs)
 	}
 
+	if strings.ToLower(args[0]) == "new" {
+		if len(args) != 3 {
+			fmt.Println("new needs the name of the template and its generic type, like new Container Item")
+			usage()
+			os.Exit(exitcodeInvalidArgs)
+		}
+		filename, err := writeStarterTemplate(args[1], args[2], *out, *pkgName)
+		if err != nil {
+			fatal(exitcodeDestFileFailed, err)
+		}
+		fmt.Fprintln(os.Stderr, "wrote", filename)
+		return
+	}
+
 	if strings.ToLower(args[0]) != "gen" && strings.ToLower(args[0]) != "get" {
 		usage()
 		os.Exit(exitcodeInvalidArgs)
 	}
 
-	// parse the typesets
-	var setsArg = args[1]
+	// parse the typesets (which aren't needed for type parameters)
+	var setsIndex = 1
 	if strings.ToLower(args[0]) == "get" {
-		setsArg = args[2]
+		setsIndex = 2
 	}
-	typeSets, err := parse.TypeSet(setsArg)
-	if err != nil {
-		fatal(exitcodeInvalidTypeSet, err)
-	}
-
-	var outWriter io.Writer
-	if len(*out) > 0 {
-		err := os.MkdirAll(path.Dir(*out), 0755)
+	var typeSets []map[string]string
+	var err error
+	if len(*typesFile) > 0 {
+		f, err := os.Open(*typesFile)
 		if err != nil {
-			fatal(exitcodeDestFileFailed, err)
+			fatal(exitcodeInvalidTypeSet, err)
 		}
-
-		outFile, err := os.Create(*out)
+		typeSets, err = parse.ReadTypeSets(*typesFile, f)
+		f.Close()
 		if err != nil {
-			fatal(exitcodeDestFileFailed, err)
+			fatal(exitcodeInvalidTypeSet, err)
 		}
-		defer outFile.Close()
-		outWriter = outFile
-	} else {
-		outWriter = os.Stdout
+	} else if len(args) > setsIndex {
+		arg, err := expandEnv(args[setsIndex])
+		if err != nil {
+			fatal(exitcodeInvalidTypeSet, err)
+		}
+		typeSets, err = parse.TypeSet(arg)
+		if err != nil {
+			fatal(exitcodeInvalidTypeSet, err)
+		}
+	} else if !*generics {
+		usage()
+		os.Exit(exitcodeInvalidArgs)
 	}
 
+	// read the source (or each of the sources matching a pattern, one at a
+	// time, below)
+	var filename = *in
+	var source io.ReadSeeker
+	batch := isGlob(*in) || len(*recursive) > 0
+	if batch && (strings.ToLower(args[0]) != "gen" || len(*out) > 0 || *watchIn) {
+		fmt.Println("-r and -in patterns only work with gen, and without -out or -watch")
+		usage()
+		os.Exit(exitcodeInvalidArgs)
+	}
+	if len(*recursive) > 0 && len(*in) > 0 {
+		fmt.Println("-r can't be used with -in")
+		usage()
+		os.Exit(exitcodeInvalidArgs)
+	}
 	if strings.ToLower(args[0]) == "get" {
-		if len(args) != 3 {
+		if len(args) < 2 {
 			fmt.Println("not enough arguments to get")
 			usage()
 			os.Exit(exitcodeInvalidArgs)
@@ -94,29 +155,161 @@ func main() {
 			fatal(exitcodeGetFailed, err)
 		}
 		r.Body.Close()
-		br := bytes.NewReader(b)
-		err = gen(*in, *pkgName, br, typeSets, *strip, outWriter)
-	} else if len(*in) > 0 {
-		var file *os.File
-		file, err = os.Open(*in)
+		if filename == "" {
+			filename = path.Base(args[1])
+		}
+		source = bytes.NewReader(b)
+	} else if len(*in) > 0 && !batch {
+		file, err := os.Open(*in)
 		if err != nil {
 			fatal(exitcodeSourceFileInvalid, err)
 		}
 		defer file.Close()
-		err = gen(*in, *pkgName, file, typeSets, *strip, outWriter)
-	} else {
-		var source []byte
-		source, err = ioutil.ReadAll(os.Stdin)
+		source = file
+	} else if !batch {
+		b, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
 			fatal(exitcodeStdinFailed, err)
 		}
-		reader := bytes.NewReader(source)
-		err = gen("stdin", *pkgName, reader, typeSets, *strip, outWriter)
+		filename = "stdin"
+		if len(*stdinName) > 0 {
+			filename = *stdinName
+		}
+		source = bytes.NewReader(b)
+	}
+
+	// when files were modified says nothing about type sets given on the
+	// command line, so -if-newer always compares input hashes
+	if *ifNewer {
+		*hash = true
+	}
+	opts := parse.Options{
+		PkgName:           *pkgName,
+		Strip:             *strip,
+		Editable:          *editable,
+		KeepGoGenerate:    *keepGoGen,
+		StripGoGenerate:   *stripGoGen,
+		GenericImportPath: *genericPkg,
+		LocalPrefix:       *local,
+		Hash:              *hash,
+		KeepGenericDecls:  *keepDecls,
+		CRLF:              *crlf,
+		PackageDoc:        *pkgDoc,
+	}
+	if *v || *vv {
+		*verbose = true
+		opts.Log = os.Stderr
+		opts.LogReplacements = *vv
+	}
+	// the output goes in the package of the files already where it is
+	// saved, if there are any
+	if opts.PkgName == "" && len(*out) > 0 {
+		if opts.PkgName, err = parse.DirPackageName(filepath.Dir(*out), *out); err != nil {
+			fatal(exitcodeDestFileFailed, err)
+		}
+	}
+
+	if len(*headerFile) > 0 {
+		b, err := ioutil.ReadFile(*headerFile)
+		if err != nil {
+			fatal(exitcodeSourceFileInvalid, err)
+		}
+		opts.Header = string(b)
+	}
+
+	if *watchIn && (len(*in) == 0 || strings.ToLower(args[0]) != "gen") {
+		fmt.Println("-watch needs gen with an -in file")
+		usage()
+		os.Exit(exitcodeInvalidArgs)
+	}
+
+	// there has to be an output file to compare with
+	if (*diff || *check) && len(*out) == 0 && len(*outPattern) == 0 && !batch {
+		fmt.Println("-diff and -check need -out or -out-pattern")
+		usage()
+		os.Exit(exitcodeInvalidArgs)
+	}
+	// -generics output has no header to put the hash in
+	if *hash && *generics {
+		fmt.Println("-hash and -if-newer don't work with -generics")
+		usage()
+		os.Exit(exitcodeInvalidArgs)
+	}
+	w := &writer{diff: *diff, check: *check, ifNewer: *ifNewer, hash: *hash}
+
+	var rep *reporter
+	if len(*reportFile) > 0 {
+		if *generics {
+			fmt.Println("-report doesn't work with -generics")
+			usage()
+			os.Exit(exitcodeInvalidArgs)
+		}
+		rep = &reporter{}
 	}
 
 	// do the work
-	if err != nil {
-		fatal(exitcodeGenFailed, err)
+	run := func(filename string, source io.ReadSeeker, out string) error {
+		if len(*outPattern) > 0 {
+			return genFiles(filename, source, typeSets, opts, *outPattern, w, *verbose, rep)
+		}
+		opts := opts
+		opts.OutFilename = out
+		upToDate, err := w.upToDate(out, source, typeSets, opts)
+		if err != nil || upToDate {
+			return err
+		}
+		output, err := gen(filename, source, typeSets, opts, *generics, *verbose, rep)
+		if err != nil {
+			return err
+		}
+		return w.write(out, output)
+	}
+
+	if batch {
+		var files []string
+		if len(*recursive) > 0 {
+			files, err = findTemplates(*recursive, opts.GenericImportPath)
+		} else {
+			files, err = globFiles(*in)
+		}
+		if err != nil {
+			fatal(exitcodeSourceFileInvalid, err)
+		}
+		if len(files) == 0 && len(*recursive) == 0 {
+			fatal(exitcodeSourceFileInvalid, "no files match "+*in)
+		}
+
+		// the type sets are shared by the templates, so each only needs
+		// the generic types it declares
+		if err := checkBatchTypes(files, typeSets, opts); err != nil {
+			fatal(exitcodeInvalidTypeSet, err)
+		}
+		opts.IgnoreUnknownGenericTypes = true
+		generated, failed := genBatch(files, run, len(*outPattern) > 0, *failFast)
+		if len(*recursive) > 0 {
+			fmt.Fprintf(os.Stderr, "generated %d of %d templates\n", generated, len(files))
+		}
+		if failed > 0 {
+			fatal(exitcodeGenFailed, fmt.Sprintf("%d of %d files failed", failed, len(files)))
+		}
+	} else {
+		if *watchIn {
+			watch(*in, func(source io.ReadSeeker) error { return run(filename, source, *out) })
+		}
+
+		if err := run(filename, source, *out); err != nil {
+			fatal(exitcodeGenFailed, err)
+		}
+	}
+
+	if rep != nil {
+		if err := rep.save(*reportFile); err != nil {
+			fatal(exitcodeDestFileFailed, err)
+		}
+	}
+
+	if len(w.stale) > 0 {
+		fatal(exitcodeOutOfDate, strings.Join(w.stale, ", ")+" out of date")
 	}
 
 }
@@ -126,9 +319,10 @@ func usage() {
 
 gen - generates type specific code from generic code.
 get <package/file> - fetch a generic template from the online library and gen it.
+new <Name> <Generic> - write a starter template for a type named after Name holding Generic values, to -out or name.genny.go.
 
 {flags}  - (optional) Command line flags (see below)
-{types}  - (required) Specific types for each generic type in the source
+{types}  - (required unless -generics or -types-file is set) Specific types for each generic type in the source
 {types} format:  {generic}={specific}[,another][ {generic2}={specific2}]
 
 Examples:
@@ -146,16 +340,194 @@ func fatal(code int, a ...interface{}) {
 }
 
 // gen performs the generic generation.
-func gen(filename, pkgName string, in io.ReadSeeker, typesets []map[string]string, strip string, out io.Writer) error {
+func gen(filename string, in io.ReadSeeker, typesets []map[string]string, opts parse.Options, generics, verbose bool, rep *reporter) ([]byte, error) {
 
-	var output []byte
-	var err error
+	if generics {
+		return parse.GenericsGenericWithOptions(filename, in, typesets, opts)
+	}
+	res, err := parse.GenericsWithResult(filename, in, typesets, opts)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		reportUnused(filename, res)
+	}
+	if rep != nil {
+		rep.add(filename, opts.OutFilename, res)
+	}
+	return res.Code, nil
+}
+
+// expandEnv expands the environment variables (like $TYPE or ${TYPE}) in
+// the type sets given on the command line. A variable that isn't set is
+// an error rather than nothing, which would give a generic type no
+// specific type.
+func expandEnv(arg string) (string, error) {
+	var missing []string
+	expanded := os.Expand(arg, func(name string) string {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s in %q isn't set", missing[0], arg)
+	}
+	return expanded, nil
+}
+
+// reportUnused prints the generic types of each type set that were never
+// replaced in the generated code.
+func reportUnused(filename string, res *parse.GenericsResult) {
+	for i, unused := range res.Unused {
+		for _, t := range unused {
+			fmt.Fprintf(os.Stderr, "%s: %s=%s is never used\n", filename, t, res.TypeSets[i][t])
+		}
+	}
+}
+
+// genFiles generates a separate file for each type set, named after the
+// pattern and saved alongside the source file.
+func genFiles(filename string, in io.ReadSeeker, typesets []map[string]string, opts parse.Options, pattern string, w *writer, verbose bool, rep *reporter) error {
+	written := make(map[string]bool)
+	for _, typeSet := range typesets {
+		name, err := parse.OutputFilename(pattern, filename, typeSet)
+		if err != nil {
+			return err
+		}
+		name = filepath.Join(filepath.Dir(filename), name)
+		if written[name] {
+			return fmt.Errorf("more than one type set would be generated into %s", name)
+		}
+		written[name] = true
+		opts.OutFilename = name
+		upToDate, err := w.upToDate(name, in, []map[string]string{typeSet}, opts)
+		if err != nil {
+			return err
+		}
+		if upToDate {
+			continue
+		}
 
-	output, err = parse.Generics(filename, pkgName, in, typesets, strip)
+		output, err := gen(filename, in, []map[string]string{typeSet}, opts, false, verbose, rep)
+		if err != nil {
+			return err
+		}
+		if err := w.write(name, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchInterval is how often watch looks for changes.
+const watchInterval = 500 * time.Millisecond
+
+// watch runs the generation every time the file changes, forever. Errors
+// are printed rather than stopping the watch.
+func watch(name string, run func(io.ReadSeeker) error) {
+	var generated os.FileInfo
+	for ; ; time.Sleep(watchInterval) {
+		info, err := os.Stat(name)
+		if err != nil || generated != nil && sameVersion(info, generated) {
+			continue
+		}
+
+		// wait for the file to stop changing
+		time.Sleep(watchInterval)
+		if settled, err := os.Stat(name); err != nil || !sameVersion(info, settled) {
+			continue
+		}
+		generated = info
+
+		src, err := ioutil.ReadFile(name)
+		if err == nil {
+			err = run(bytes.NewReader(src))
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, "generated from", name)
+	}
+}
+
+// sameVersion gets whether the file info is for the same version of a
+// file.
+func sameVersion(a, b os.FileInfo) bool {
+	return a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// writer saves the generated code, or compares it with the code
+// generated before.
+type writer struct {
+	// diff prints the changes instead of saving them.
+	diff bool
+	// check records the files that would change instead of saving them.
+	check bool
+	// stale are the files that are out of date.
+	stale []string
+	// ifNewer only saves files whose inputs have changed.
+	ifNewer bool
+	// hash compares the input hashes of files, and is always set with
+	// ifNewer.
+	hash bool
+}
+
+// upToDate gets whether the file with the name doesn't need generating
+// from the source again, which is when hash is set (for -check or
+// -if-newer) and the file has the same input hash as the source, type
+// sets and options.
+func (w *writer) upToDate(name string, source io.ReadSeeker, typeSets []map[string]string, opts parse.Options) (bool, error) {
+	if name == "" || w.diff || !w.hash || !w.ifNewer && !w.check {
+		return false, nil
+	}
+	existing, err := ioutil.ReadFile(name)
 	if err != nil {
+		return false, nil
+	}
+	source.Seek(0, io.SeekStart)
+	src, err := ioutil.ReadAll(source)
+	if err != nil {
+		return false, err
+	}
+	return parse.ReadHash(existing) == parse.InputHashWithOptions(src, typeSets, opts), nil
+}
+
+// write saves the output to the file with the name, or writes it to
+// stdout if there is no name.
+func (w *writer) write(name string, output []byte) error {
+	if name == "" {
+		_, err := os.Stdout.Write(output)
 		return err
 	}
 
-	out.Write(output)
+	if !w.diff && !w.check {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(name, output, 0644)
+	}
+
+	existing, err := ioutil.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if bytes.Equal(existing, output) {
+		return nil
+	}
+	if w.check {
+		w.stale = append(w.stale, name)
+	}
+	if w.diff {
+		return difflib.WriteUnifiedDiff(os.Stdout, difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(existing)),
+			B:        difflib.SplitLines(string(output)),
+			FromFile: name,
+			ToFile:   name + " (generated)",
+			Context:  3,
+		})
+	}
 	return nil
 }
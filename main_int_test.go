@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joelrahman/genny/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+// runMainEnv is set when the test binary is run as genny by runMain.
+const runMainEnv = "GENNY_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs genny with the args in the directory, getting what it
+// printed and its exit code.
+func runMain(t *testing.T, dir string, args ...string) (string, int) {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	if exit, ok := err.(*exec.ExitError); ok {
+		return string(out), exit.ExitCode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+func TestTypesFile(t *testing.T) {
+
+	dir, cleanup := tempTree(t, map[string]string{
+		"queue.go":   queueTemplate,
+		"types.json": `[{"Item": "int"}, {"Item": "string"}]`,
+		"types.yaml": "- Item: float64\n",
+		"bad.json":   `{"Item": "int"}`,
+	})
+	defer cleanup()
+
+	out, code := runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "-types-file=types.json", "gen")
+	if assert.Equal(t, 0, code, out) {
+		generated, err := ioutil.ReadFile(filepath.Join(dir, "queue_gen.go"))
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(generated), "type IntQueue []int")
+			assert.Contains(t, string(generated), "type StringQueue []string")
+		}
+	}
+
+	// the types file is used instead of the type sets on the command line
+	out, code = runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "-types-file=types.yaml", "gen", "Item=int")
+	if assert.Equal(t, 0, code, out) {
+		generated, err := ioutil.ReadFile(filepath.Join(dir, "queue_gen.go"))
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(generated), "type Float64Queue []float64")
+			assert.NotContains(t, string(generated), "IntQueue")
+		}
+	}
+
+	_, code = runMain(t, dir, "-in=queue.go", "-types-file=bad.json", "gen")
+	assert.Equal(t, exitcodeInvalidTypeSet, code)
+	_, code = runMain(t, dir, "-in=queue.go", "-types-file=missing.json", "gen")
+	assert.Equal(t, exitcodeInvalidTypeSet, code)
+
+}
+
+func TestIfNewerTypeSetsChange(t *testing.T) {
+
+	dir, cleanup := tempTree(t, map[string]string{"queue.go": queueTemplate})
+	defer cleanup()
+	filename := filepath.Join(dir, "queue.go")
+	out := filepath.Join(dir, "queue_gen.go")
+	w := &writer{ifNewer: true, hash: true}
+	opts := parse.Options{Hash: true, OutFilename: out}
+
+	// generate like run does, returning whether the file was up to date
+	generate := func(typeSets []map[string]string) bool {
+		source := strings.NewReader(queueTemplate)
+		upToDate, err := w.upToDate(out, source, typeSets, opts)
+		if !assert.NoError(t, err) || upToDate {
+			return upToDate
+		}
+		output, err := gen(filename, source, typeSets, opts, false, false, nil)
+		if assert.NoError(t, err) {
+			assert.NoError(t, w.write(out, output))
+		}
+		return false
+	}
+
+	ints := []map[string]string{{"Item": "int"}}
+	assert.False(t, generate(ints))
+	assert.True(t, generate(ints))
+
+	// the template hasn't changed, but the type sets have
+	assert.False(t, generate([]map[string]string{{"Item": "string"}}))
+	code, err := ioutil.ReadFile(out)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(code), "type StringQueue []string")
+		assert.NotContains(t, string(code), "IntQueue")
+	}
+
+	// nor have the type sets, but the options have
+	opts.PkgName = "queues"
+	assert.False(t, generate([]map[string]string{{"Item": "string"}}))
+	code, err = ioutil.ReadFile(out)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(code), "package queues\n")
+	}
+
+}
+
+func TestExpandEnv(t *testing.T) {
+
+	os.Setenv("GENNY_TEST_TYPE", "int")
+	defer os.Unsetenv("GENNY_TEST_TYPE")
+	os.Unsetenv("GENNY_TEST_UNSET")
+
+	for _, test := range []struct {
+		arg      string
+		expanded string
+		err      string
+	}{
+		{"Item=string", "Item=string", ""},
+		{"Item=$GENNY_TEST_TYPE", "Item=int", ""},
+		{"Item=${GENNY_TEST_TYPE},string", "Item=int,string", ""},
+		{"Item=${GENNY_TEST_TYPE}64", "Item=int64", ""},
+		{"Item=$GENNY_TEST_UNSET", "", `environment variable GENNY_TEST_UNSET in "Item=$GENNY_TEST_UNSET" isn't set`},
+		{"Item=${GENNY_TEST_UNSET}", "", `environment variable GENNY_TEST_UNSET in "Item=${GENNY_TEST_UNSET}" isn't set`},
+	} {
+		expanded, err := expandEnv(test.arg)
+		if test.err != "" {
+			assert.EqualError(t, err, test.err, test.arg)
+			continue
+		}
+		if assert.NoError(t, err, test.arg) {
+			assert.Equal(t, test.expanded, expanded, test.arg)
+		}
+	}
+
+}
+
+func TestDiffAndCheck(t *testing.T) {
+
+	dir, cleanup := tempTree(t, map[string]string{"queue.go": queueTemplate})
+	defer cleanup()
+	out := filepath.Join(dir, "queue_gen.go")
+
+	// the file doesn't change when checking or diffing
+	if err := ioutil.WriteFile(out, []byte("package queue\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := &writer{check: true}
+	assert.NoError(t, w.write(out, []byte("package queue\n")))
+	assert.Empty(t, w.stale)
+	assert.NoError(t, w.write(out, []byte("package queue\n\ntype IntQueue []int\n")))
+	assert.Equal(t, []string{out}, w.stale)
+	code, err := ioutil.ReadFile(out)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "package queue\n", string(code))
+	}
+
+	printed, exit := runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "-diff", "gen", "Item=int")
+	if assert.Equal(t, 0, exit, printed) {
+		assert.Contains(t, printed, "--- queue_gen.go\n+++ queue_gen.go (generated)\n")
+		assert.Contains(t, printed, "+type IntQueue []int\n")
+	}
+	printed, exit = runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "-check", "gen", "Item=int")
+	assert.Equal(t, exitcodeOutOfDate, exit)
+	assert.Contains(t, printed, "queue_gen.go out of date")
+
+	// once it's generated it's up to date
+	printed, exit = runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "gen", "Item=int")
+	assert.Equal(t, 0, exit, printed)
+	printed, exit = runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "-check", "gen", "Item=int")
+	assert.Equal(t, 0, exit, printed)
+	printed, exit = runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "-diff", "gen", "Item=int")
+	if assert.Equal(t, 0, exit, printed) {
+		assert.Empty(t, printed)
+	}
+
+	// there has to be a file to compare with
+	for _, flag := range []string{"-diff", "-check"} {
+		printed, exit = runMain(t, dir, "-in=queue.go", flag, "gen", "Item=int")
+		assert.Equal(t, exitcodeInvalidArgs, exit, flag)
+		assert.Contains(t, printed, "-diff and -check need -out or -out-pattern", flag)
+	}
+
+}
+
+func TestWatch(t *testing.T) {
+
+	dir, cleanup := tempTree(t, map[string]string{"queue.go": queueTemplate})
+	defer cleanup()
+	filename := filepath.Join(dir, "queue.go")
+
+	// a run that fails shouldn't stop the watch
+	runs := make(chan string)
+	go watch(filename, func(source io.ReadSeeker) error {
+		src, err := ioutil.ReadAll(source)
+		if err != nil {
+			return err
+		}
+		runs <- string(src)
+		if strings.Contains(string(src), "broken") {
+			return errors.New("broken")
+		}
+		return nil
+	})
+	next := func() string {
+		select {
+		case src := <-runs:
+			return src
+		case <-time.After(10 * watchInterval):
+			t.Fatal("the watch didn't run")
+			return ""
+		}
+	}
+
+	assert.Equal(t, queueTemplate, next())
+	for _, src := range []string{queueTemplate + "\n// broken\n", queueTemplate + "\n// fixed\n"} {
+		if err := ioutil.WriteFile(filename, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, src, next())
+	}
+
+	// it only runs when the file changes
+	select {
+	case <-runs:
+		t.Error("the watch ran without the file changing")
+	case <-time.After(3 * watchInterval):
+	}
+
+	printed, exit := runMain(t, dir, "-watch", "gen", "Item=int")
+	assert.Equal(t, exitcodeInvalidArgs, exit)
+	assert.Contains(t, printed, "-watch needs gen with an -in file")
+
+}
+
+func TestNewTemplate(t *testing.T) {
+
+	dir, cleanup := tempTree(t, map[string]string{"other/other.go": "package others\n"})
+	defer cleanup()
+
+	printed, exit := runMain(t, dir, "new", "Container", "Item")
+	if !assert.Equal(t, 0, exit, printed) {
+		return
+	}
+	filename := filepath.Join(dir, "container.genny.go")
+	template, err := ioutil.ReadFile(filename)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(template), "package container\n")
+	assert.Contains(t, string(template), "//go:generate genny -in=$GOFILE -out=container.go gen \"Item=string,int\"\n")
+	assert.Contains(t, string(template), "type Item generic.Type\n")
+
+	// the template can be generated from
+	code, err := gen(filename, strings.NewReader(string(template)), []map[string]string{{"Item": "int"}}, parse.Options{}, false, false, nil)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(code), "type IntContainer struct {\n\tvalues []int\n}")
+		assert.Contains(t, string(code), "func (c *IntContainer) Add(v int) {")
+	}
+
+	// it won't overwrite the template
+	if err := ioutil.WriteFile(filename, []byte("package container\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	printed, exit = runMain(t, dir, "new", "Container", "Item")
+	assert.Equal(t, exitcodeDestFileFailed, exit)
+	assert.Contains(t, printed, "container.genny.go already exists")
+	template, err = ioutil.ReadFile(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "package container\n", string(template))
+	}
+
+	// the package is the one already where it's saved
+	name, err := writeStarterTemplate("set", "Key", filepath.Join(dir, "other", "set.genny.go"), "")
+	if assert.NoError(t, err) {
+		template, err := ioutil.ReadFile(name)
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(template), "package others\n")
+			assert.Contains(t, string(template), "type KeySet struct {")
+			assert.Contains(t, string(template), "// KeySet is a set of Key values.")
+		}
+	}
+
+	_, err = writeStarterTemplate("Container", "Item", filepath.Join(dir, "pkg.genny.go"), "things")
+	if assert.NoError(t, err) {
+		template, err := ioutil.ReadFile(filepath.Join(dir, "pkg.genny.go"))
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(template), "package things\n")
+		}
+	}
+
+	_, err = writeStarterTemplate("my-container", "Item", filepath.Join(dir, "bad.genny.go"), "")
+	assert.EqualError(t, err, `"my-container" isn't a valid Go identifier`)
+	printed, exit = runMain(t, dir, "new", "Container")
+	assert.Equal(t, exitcodeInvalidArgs, exit)
+	assert.Contains(t, printed, "new needs the name of the template and its generic type")
+
+}
+
+func TestReport(t *testing.T) {
+
+	dir, cleanup := tempTree(t, map[string]string{"queue.go": queueTemplate})
+	defer cleanup()
+
+	printed, exit := runMain(t, dir, "-in=queue.go", "-out=queue_gen.go", "-report=report.json", "gen", "Item=int,bytes.Buffer")
+	if !assert.Equal(t, 0, exit, printed) {
+		return
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "report.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var report []map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(b, &report)) && assert.Len(t, report, 1) {
+		assert.Equal(t, map[string]interface{}{
+			"in":      "queue.go",
+			"out":     "queue_gen.go",
+			"package": "queue",
+			"typeSets": []interface{}{
+				map[string]interface{}{"Item": "int"},
+				map[string]interface{}{"Item": "bytes.Buffer"},
+			},
+			"symbols":      []interface{}{"IntQueue", "BytesBufferQueue"},
+			"imports":      []interface{}{"bytes"},
+			"addedImports": []interface{}{"bytes"},
+			"cgo":          false,
+		}, report[0])
+	}
+
+	// nothing generated is an empty array rather than null
+	name := filepath.Join(dir, "empty.json")
+	if assert.NoError(t, (&reporter{}).save(name)) {
+		b, err := ioutil.ReadFile(name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "[]\n", string(b))
+		}
+	}
+
+	printed, exit = runMain(t, dir, "-in=queue.go", "-report=report.json", "-generics", "gen")
+	assert.Equal(t, exitcodeInvalidArgs, exit)
+	assert.Contains(t, printed, "-report doesn't work with -generics")
+
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/joelrahman/genny/parse"
+)
+
+// starterTemplate is the template genny new writes, for a type named
+// after the template holding values of the generic type.
+var starterTemplate = template.Must(template.New("new").Parse(`package {{.Package}}
+
+import "github.com/joelrahman/genny/generic"
+
+//go:generate genny -in=$GOFILE -out={{.Out}} gen "{{.Generic}}=string,int"
+
+// {{.Generic}} is the generic type, which is replaced by each specific type.
+type {{.Generic}} generic.Type
+
+// {{.Type}} is a {{.Name}} of {{.Generic}} values.
+type {{.Type}} struct {
+	values []{{.Generic}}
+}
+
+// New{{.Type}} makes an empty {{.Type}}.
+func New{{.Type}}() *{{.Type}} {
+	return &{{.Type}}{}
+}
+
+// Add adds the value to the {{.Type}}.
+func (c *{{.Type}}) Add(v {{.Generic}}) {
+	c.values = append(c.values, v)
+}
+
+// Len gets how many values are in the {{.Type}}.
+func (c *{{.Type}}) Len() int {
+	return len(c.values)
+}
+`))
+
+// writeStarterTemplate writes a starter template for genny new, naming
+// the type it declares after name and its generic type genericType. It
+// is saved to filename, or to name.genny.go if that is empty, in the
+// package pkgName or else the package of the other files there. It gets
+// the name of the file, and won't overwrite one that already exists.
+func writeStarterTemplate(name, genericType, filename, pkgName string) (string, error) {
+	for _, ident := range []string{name, genericType} {
+		if !token.IsIdentifier(ident) {
+			return "", fmt.Errorf("%q isn't a valid Go identifier", ident)
+		}
+	}
+	if filename == "" {
+		filename = strings.ToLower(name) + templateSuffix
+	}
+	if pkgName == "" {
+		var err error
+		if pkgName, err = parse.DirPackageName(filepath.Dir(filename), filename); err != nil {
+			return "", err
+		}
+	}
+	if pkgName == "" {
+		pkgName = strings.ToLower(name)
+	}
+
+	out := strings.TrimSuffix(filepath.Base(filename), templateSuffix) + ".go"
+	if out == filepath.Base(filename) {
+		out = "gen-" + out
+	}
+	first, rest := []rune(name)[0], string([]rune(name)[1:])
+	var buf bytes.Buffer
+	err := starterTemplate.Execute(&buf, map[string]string{
+		"Package": pkgName,
+		"Out":     out,
+		"Generic": genericType,
+		"Name":    string(unicode.ToLower(first)) + rest,
+		"Type":    genericType + string(unicode.ToUpper(first)) + rest,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return "", fmt.Errorf("%s already exists", filename)
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return "", err
+	}
+	return filename, f.Close()
+}
@@ -1,5 +1,12 @@
 package parse
 
+import (
+	"go/ast"
+	"go/parser"
+	"strconv"
+	"strings"
+)
+
 // Builtins contains a slice of all built-in Go types.
 var Builtins = []string{
 	"bool",
@@ -39,3 +46,86 @@ var Numbers = []string{
 	"uint64",
 	"uint8",
 }
+
+// constraints maps the generic placeholder types that constrain their
+// specific types to the check each specific type must pass.
+var constraints = map[string]func(string) bool{
+	"String":  isStringType,
+	"Ordered": isOrderedType,
+	"Size":    isSizeLiteral,
+}
+
+// isStringType gets whether the specific type could be a string type.
+// Any built-in or composite type other than string is rejected, while
+// named types are assumed to be defined string types.
+func isStringType(specific string) bool {
+	if specific == "string" {
+		return true
+	}
+	return isNamedType(specific)
+}
+
+// isOrderedType gets whether the specific type could be ordered with <.
+// Built-in numbers and strings are accepted, along with named types which
+// are assumed to be defined ordered types.
+func isOrderedType(specific string) bool {
+	for _, ordered := range append(Numbers, "byte", "rune", "uintptr", "string") {
+		if specific == ordered {
+			return true
+		}
+	}
+	return isNamedType(specific)
+}
+
+// isNamedType gets whether the specific type is neither a built-in nor a
+// composite type (or a union).
+func isNamedType(specific string) bool {
+	for _, b := range Builtins {
+		if specific == b {
+			return false
+		}
+	}
+	return !strings.ContainsAny(specific, "[]*{}()| ")
+}
+
+// isSizeLiteral gets whether the specific type is an integer literal that
+// can be used as the length of an array.
+func isSizeLiteral(specific string) bool {
+	n, err := strconv.ParseInt(specific, 0, 64)
+	return err == nil && n >= 0
+}
+
+// zeroValue gets the zero value of the specific type as it is written in
+// code. Named types could be anything, so *new(T) is used for them.
+func zeroValue(specific string) string {
+	if isUnion(specific) {
+		return "nil"
+	}
+	expr, err := parser.ParseExpr(specific)
+	if err != nil {
+		return "*new(" + specific + ")"
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case isBuiltinNumber(specific) || specific == "complex64" || specific == "complex128":
+			return "0"
+		case specific == "string":
+			return `""`
+		case specific == "bool":
+			return "false"
+		case specific == "error":
+			return "nil"
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return "nil"
+	case *ast.ArrayType:
+		if e.Len == nil {
+			return "nil"
+		}
+		return specific + "{}"
+	case *ast.StructType:
+		return specific + "{}"
+	}
+	return "*new(" + specific + ")"
+}
@@ -0,0 +1,171 @@
+package parse
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+)
+
+// dedupeDecls removes top-level declarations that are exactly the same as
+// one earlier in the source, which happens when a declaration in the
+// template doesn't refer to any of the generic types (or two type sets
+// resolve to the same specific types). It returns the cleaned source along
+// with the names of the declarations it dropped.
+//
+// If the source can't be parsed it is returned untouched so the error can
+// be reported when it is formatted.
+func dedupeDecls(filename string, src []byte) ([]byte, []string) {
+	fs := token.NewFileSet()
+	file, err := parser.ParseFile(fs, filename, src, parser.ParseComments)
+	if err != nil {
+		return src, nil
+	}
+
+	seen := make(map[string]bool)
+	var dropped []string
+	var out bytes.Buffer
+	last := 0
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+
+		key, ok := normalDecl(fs, decl)
+		if !ok {
+			continue
+		}
+		if !seen[key] {
+			seen[key] = true
+			continue
+		}
+
+		// cut the declaration (and its doc comment) out of the source
+		start := fs.Position(decl.Pos()).Offset
+		if doc := declDoc(decl); doc != nil {
+			start = fs.Position(doc.Pos()).Offset
+		}
+		if start > 1 && src[start-1] == '\n' && src[start-2] == '\n' {
+			start--
+		}
+		end := fs.Position(decl.End()).Offset
+		if end < len(src) && src[end] == '\n' {
+			end++
+		}
+		out.Write(src[last:start])
+		last = end
+		dropped = append(dropped, declName(decl))
+	}
+	if len(dropped) == 0 {
+		return src, nil
+	}
+	out.Write(src[last:])
+	return out.Bytes(), dropped
+}
+
+// topLevelDecls gets the formatted code of each top-level declaration in
+// the source keyed by its name, leaving out those without a name of their
+// own (see unnamed). Nothing is returned if the source can't be parsed.
+func topLevelDecls(filename string, src []byte) map[string]string {
+	fs := token.NewFileSet()
+	file, err := parser.ParseFile(fs, filename, src, 0)
+	if err != nil {
+		return nil
+	}
+	decls := make(map[string]string)
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT || unnamed(decl) {
+			continue
+		}
+		if code, ok := normalDecl(fs, decl); ok {
+			decls[declName(decl)] = code
+		}
+	}
+	return decls
+}
+
+// normalDecl formats the declaration without its doc comment so it can be
+// compared with others.
+func normalDecl(fs *token.FileSet, decl ast.Decl) (string, bool) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fs, withoutDoc(decl)); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// withoutDoc gets a copy of the declaration with its doc comment removed
+// so declarations are compared on their code alone.
+func withoutDoc(decl ast.Decl) ast.Decl {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		c := *d
+		c.Doc = nil
+		return &c
+	case *ast.GenDecl:
+		c := *d
+		c.Doc = nil
+		return &c
+	}
+	return decl
+}
+
+// declDoc gets the doc comment of a top-level declaration.
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+// unnamed gets whether a top-level declaration can be declared any number
+// of times with different code, which is the case for init funcs and
+// declarations of only blank identifiers (like var _ fmt.Stringer = v).
+func unnamed(decl ast.Decl) bool {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Recv == nil && d.Name.Name == "init"
+	case *ast.GenDecl:
+		if d.Tok != token.VAR && d.Tok != token.CONST {
+			return false
+		}
+		for _, spec := range d.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				if name.Name != "_" {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// declName gets a readable name for a top-level declaration.
+func declName(decl ast.Decl) string {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			return types.ExprString(d.Recv.List[0].Type) + "." + d.Name.Name
+		}
+		return d.Name.Name
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				return s.Name.Name
+			case *ast.ValueSpec:
+				if len(s.Names) > 0 {
+					return s.Names[0].Name
+				}
+			}
+		}
+		return d.Tok.String()
+	}
+	return ""
+}
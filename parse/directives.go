@@ -0,0 +1,118 @@
+package parse
+
+import (
+	"go/token"
+	"strings"
+)
+
+// directivePrefix starts the comments that control what code genny
+// generates.
+const directivePrefix = "//genny:"
+
+// conditionKinds maps the kinds a //genny:if directive can test for to the
+// check a specific type must pass to be that kind. Only built-in types can
+// be told apart, so named types are only ever of kind Type.
+var conditionKinds = map[string]func(string) bool{
+	"Type":    func(string) bool { return true },
+	"Number":  isBuiltinNumber,
+	"String":  func(specific string) bool { return specific == "string" },
+	"Ordered": func(specific string) bool { return specific == "string" || isBuiltinNumber(specific) },
+}
+
+// isBuiltinNumber gets whether the specific type is a built-in number type.
+func isBuiltinNumber(specific string) bool {
+	for _, number := range append(Numbers, "byte", "rune", "uintptr") {
+		if specific == number {
+			return true
+		}
+	}
+	return false
+}
+
+// directive is a //genny: comment that controls what code is generated.
+type directive struct {
+	name string
+	cond condition
+	// end is the index of the last line of the declaration a skip-if
+	// directive applies to.
+	end int
+	// names are the generic types a type directive declares.
+	names []string
+}
+
+// condition is the kind of specific type a directive tests for.
+type condition struct {
+	// generic is the generic type whose specific type is tested, or empty
+	// to test the specific type of every generic type.
+	generic string
+	kind    string
+}
+
+// met gets whether the specific types of the type set are of the kind.
+func (c condition) met(typeSet map[string]string) bool {
+	is := conditionKinds[c.kind]
+	if c.generic != "" {
+		specific, ok := typeSet[c.generic]
+		return ok && is(specific)
+	}
+	for _, specific := range typeSet {
+		if !is(specific) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseDirective parses a line of the source that might be a directive,
+// like:
+//
+//     //genny:if Number
+//     //genny:if KeyType String
+//     //genny:endif
+//     //genny:skip-if String
+//     //genny:type Item
+//
+// Other //genny: comments aren't directives and are left alone.
+func parseDirective(l string, pos token.Position) (*directive, error) {
+	l = strings.TrimSpace(l)
+	if !strings.HasPrefix(l, directivePrefix) {
+		return nil, nil
+	}
+	fields := strings.Fields(l[len(directivePrefix):])
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	d := &directive{name: fields[0]}
+	args := fields[1:]
+	switch d.name {
+	case "if", "skip-if":
+		switch len(args) {
+		case 1:
+			d.cond.kind = args[0]
+		case 2:
+			d.cond.generic, d.cond.kind = args[0], args[1]
+		default:
+			return nil, &errBadDirective{Directive: l, Position: pos, Reason: "expected a kind, optionally after a generic type"}
+		}
+		if _, ok := conditionKinds[d.cond.kind]; !ok {
+			return nil, &errBadDirective{Directive: l, Position: pos, Reason: "'" + d.cond.kind + "' is not a kind of type"}
+		}
+	case "endif":
+		if len(args) > 0 {
+			return nil, &errBadDirective{Directive: l, Position: pos, Reason: "expected nothing after endif"}
+		}
+	case "type":
+		if len(args) == 0 {
+			return nil, &errBadDirective{Directive: l, Position: pos, Reason: "expected the names of generic types"}
+		}
+		for _, name := range args {
+			if !isIdentifier(name) {
+				return nil, &errBadDirective{Directive: l, Position: pos, Reason: "'" + name + "' is not a name"}
+			}
+		}
+		d.names = args
+	default:
+		return nil, nil
+	}
+	return d, nil
+}
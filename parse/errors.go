@@ -2,27 +2,339 @@ package parse
 
 import (
 	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// The kinds of error returned, which errors.Is can tell apart:
+//
+//	if errors.Is(err, parse.ErrMissingSpecificType) {
+//		// ...
+//	}
+//
+// The errors themselves describe what went wrong in more detail.
+var (
+	// ErrSource is returned when the source file can't be read or parsed.
+	ErrSource = errors.New("Bad source file")
+	// ErrMissingSpecificType is returned when a generic type has no
+	// specific type.
+	ErrMissingSpecificType = errors.New("Missing specific type")
+	// ErrIncompatibleSpecificType is returned when a specific type can't
+	// be used for its kind of generic type.
+	ErrIncompatibleSpecificType = errors.New("Incompatible specific type")
+	// ErrUnsupportedCType is returned when a specific type has no C type.
+	ErrUnsupportedCType = errors.New("Unsupported C type")
+	// ErrUndeclaredGeneric is returned when the generic packages are
+	// used other than to declare generic types.
+	ErrUndeclaredGeneric = errors.New("Undeclared generic type")
+	// ErrBadDirective is returned when a //genny: directive can't be
+	// used.
+	ErrBadDirective = errors.New("Bad directive")
+	// ErrNameCollision is returned when two type sets generate different
+	// code with the same name.
+	ErrNameCollision = errors.New("Name collision")
+	// ErrGenericsUnsupported is returned when code can't be generated
+	// with type parameters.
+	ErrGenericsUnsupported = errors.New("Type parameters unsupported")
+	// ErrDuplicateOutput is returned when two type sets would be
+	// generated into the same file.
+	ErrDuplicateOutput = errors.New("Duplicate output file")
+	// ErrImports is returned when goimports fails on the generated code.
+	ErrImports = errors.New("Failed to goimports")
+	// ErrBadTypeSets is returned when the type sets given can't be used.
+	ErrBadTypeSets = errors.New("Bad type sets")
+)
+
+// PositionError is an error about a position in the source, whose message
+// starts with the position (like generic_queue.go:5:6) when it is valid.
+// errors.As gets it from the errors returned:
+//
+//	var perr parse.PositionError
+//	if errors.As(err, &perr) {
+//		pos := perr.Pos()
+//		// ...
+//	}
+type PositionError interface {
+	error
+	Pos() token.Position
+}
+
 // errMissingSpecificType represents an error when a generic type is not
 // satisfied by a specific type.
 type errMissingSpecificType struct {
 	GenericType string
+	Position    token.Position
 }
 
 // Error gets a human readable string describing this error.
 func (e errMissingSpecificType) Error() string {
-	return "Missing specific type for '" + e.GenericType + "' generic type"
+	msg := "Missing specific type for '" + e.GenericType + "' generic type"
+	if e.Position.IsValid() {
+		return e.Position.String() + ": " + msg
+	}
+	return msg
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errMissingSpecificType) Is(target error) bool {
+	return target == ErrMissingSpecificType
+}
+
+// Pos gets the position of the generic type in the source.
+func (e errMissingSpecificType) Pos() token.Position {
+	return e.Position
+}
+
+// errMissingSpecificTypes represents an error when one or more generic
+// types are not satisfied by a specific type.
+type errMissingSpecificTypes struct {
+	Missing []errMissingSpecificType
+}
+
+// Error gets a human readable string describing this error.
+func (e errMissingSpecificTypes) Error() string {
+	lines := make([]string, len(e.Missing))
+	for i, missing := range e.Missing {
+		lines[i] = missing.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errMissingSpecificTypes) Is(target error) bool {
+	return target == ErrMissingSpecificType
+}
+
+// Pos gets the position of the first generic type in the source.
+func (e errMissingSpecificTypes) Pos() token.Position {
+	if len(e.Missing) == 0 {
+		return token.Position{}
+	}
+	return e.Missing[0].Position
+}
+
+// errUndeclaredGeneric represents an error when one of the generic
+// packages is used other than to declare a generic type.
+type errUndeclaredGeneric struct {
+	Reference string
+	Reason    string
+	Position  token.Position
+}
+
+// Error gets a human readable string describing this error.
+func (e errUndeclaredGeneric) Error() string {
+	msg := "'" + e.Reference + "' " + e.Reason
+	if e.Position.IsValid() {
+		return e.Position.String() + ": " + msg
+	}
+	return msg
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errUndeclaredGeneric) Is(target error) bool {
+	return target == ErrUndeclaredGeneric
+}
+
+// Pos gets the position of the reference in the source.
+func (e errUndeclaredGeneric) Pos() token.Position {
+	return e.Position
+}
+
+// errUndeclaredGenerics represents an error when the generic packages are
+// used other than to declare generic types one or more times.
+type errUndeclaredGenerics struct {
+	References []errUndeclaredGeneric
+}
+
+// Error gets a human readable string describing this error.
+func (e errUndeclaredGenerics) Error() string {
+	lines := make([]string, len(e.References))
+	for i, ref := range e.References {
+		lines[i] = ref.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errUndeclaredGenerics) Is(target error) bool {
+	return target == ErrUndeclaredGeneric
+}
+
+// Pos gets the position of the first reference in the source.
+func (e errUndeclaredGenerics) Pos() token.Position {
+	if len(e.References) == 0 {
+		return token.Position{}
+	}
+	return e.References[0].Position
+}
+
+// errIncompatibleSpecificType represents an error when a specific type
+// cannot be used for the kind of generic type it replaces.
+type errIncompatibleSpecificType struct {
+	GenericType  string
+	SpecificType string
+	Kind         string
+}
+
+// Error gets a human readable string describing this error.
+func (e errIncompatibleSpecificType) Error() string {
+	return "Specific type '" + e.SpecificType + "' cannot be used for '" + e.GenericType + "' which is a " + e.Kind
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errIncompatibleSpecificType) Is(target error) bool {
+	return target == ErrIncompatibleSpecificType
+}
+
+// errUnsupportedCType represents an error when a C type is needed for a
+// specific type that has no known C type.
+type errUnsupportedCType struct {
+	CType        string
+	SpecificType string
+}
+
+// Error gets a human readable string describing this error.
+func (e errUnsupportedCType) Error() string {
+	return "Specific type '" + e.SpecificType + "' has no C type to use for '" + e.CType + "' (it can be given in the CTypes option)"
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errUnsupportedCType) Is(target error) bool {
+	return target == ErrUnsupportedCType
+}
+
+// errBadDirective represents an error when a //genny: directive in the
+// source can't be used.
+type errBadDirective struct {
+	Directive string
+	Position  token.Position
+	Reason    string
+}
+
+// Error gets a human readable string describing this error.
+func (e errBadDirective) Error() string {
+	msg := "Bad directive '" + e.Directive + "': " + e.Reason
+	if e.Position.IsValid() {
+		return e.Position.String() + ": " + msg
+	}
+	return msg
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errBadDirective) Is(target error) bool {
+	return target == ErrBadDirective
+}
+
+// Pos gets the position of the directive in the source.
+func (e errBadDirective) Pos() token.Position {
+	return e.Position
 }
 
-// errImports represents an error from goimports.
+// errNameCollision represents an error when two type sets generate
+// different declarations with the same name.
+type errNameCollision struct {
+	Name         string
+	TypeSet      map[string]string
+	OtherTypeSet map[string]string
+}
+
+// Error gets a human readable string describing this error.
+func (e errNameCollision) Error() string {
+	return "Type sets \"" + formatTypeSet(e.OtherTypeSet) + "\" and \"" + formatTypeSet(e.TypeSet) + "\" both generate '" + e.Name + "'"
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errNameCollision) Is(target error) bool {
+	return target == ErrNameCollision
+}
+
+// formatTypeSet formats a type set the way it would be given on the
+// command line.
+func formatTypeSet(typeSet map[string]string) string {
+	pairs := make([]string, 0, len(typeSet))
+	for k, v := range typeSet {
+		pairs = append(pairs, k+keyValueSep+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, typeSep)
+}
+
+// errGenericsUnsupported represents an error when a template can't be
+// turned into code with type parameters.
+type errGenericsUnsupported struct {
+	Name   string
+	Reason string
+}
+
+// Error gets a human readable string describing this error.
+func (e errGenericsUnsupported) Error() string {
+	return "Cannot use type parameters for '" + e.Name + "': " + e.Reason
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errGenericsUnsupported) Is(target error) bool {
+	return target == ErrGenericsUnsupported
+}
+
+// errDuplicateOutput represents an error when more than one type set
+// would be generated into the same file.
+type errDuplicateOutput struct {
+	Filename string
+}
+
+// Error gets a human readable string describing this error.
+func (e errDuplicateOutput) Error() string {
+	return "More than one type set would be generated into '" + e.Filename + "'"
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errDuplicateOutput) Is(target error) bool {
+	return target == ErrDuplicateOutput
+}
+
+// errImports represents an error from goimports. Source is the code
+// that goimports failed on.
 type errImports struct {
-	Err error
+	Err    error
+	Source []byte
 }
 
 // Error gets a human readable string describing this error.
 func (e errImports) Error() string {
-	return "Failed to goimports the generated code: " + e.Err.Error()
+	msg := "Failed to goimports the generated code: " + e.Err.Error()
+	var list scanner.ErrorList
+	if !errors.As(e.Err, &list) || len(list) == 0 || len(e.Source) == 0 {
+		return msg
+	}
+
+	// show the lines around the first error
+	lines := strings.Split(string(e.Source), "\n")
+	line := list[0].Pos.Line
+	for n := line - 1; n <= line+1; n++ {
+		if n < 1 || n > len(lines) {
+			continue
+		}
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		msg += fmt.Sprintf("\n%s %4d | %s", marker, n, lines[n-1])
+	}
+	return msg
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errImports) Is(target error) bool {
+	return target == ErrImports
+}
+
+// Unwrap gets the error this error wraps.
+func (e errImports) Unwrap() error {
+	return e.Err
 }
 
 // errSource represents an error with the source file.
@@ -35,6 +347,58 @@ func (e errSource) Error() string {
 	return "Failed to parse source file: " + e.Err.Error()
 }
 
+// Is gets whether target is the kind of error this is.
+func (e errSource) Is(target error) bool {
+	return target == ErrSource
+}
+
+// Unwrap gets the error this error wraps.
+func (e errSource) Unwrap() error {
+	return e.Err
+}
+
+// errUnknownGenericType represents an error when a type set has a type
+// for a generic type the source doesn't declare.
+type errUnknownGenericType struct {
+	GenericType string
+	Declared    []string
+}
+
+// Error gets a human readable string describing this error.
+func (e errUnknownGenericType) Error() string {
+	if len(e.Declared) == 0 {
+		return "Type set has a specific type for '" + e.GenericType + "' but the source declares no generic types"
+	}
+	return "Type set has a specific type for '" + e.GenericType + "' which isn't a generic type in the source (they are " + strings.Join(e.Declared, ", ") + ")"
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errUnknownGenericType) Is(target error) bool {
+	return target == ErrBadTypeSets
+}
+
+// errSelfReferentialType represents an error when the specific type for a
+// generic type is the generic type itself, or has another generic type of
+// the type set (Other) in it.
+type errSelfReferentialType struct {
+	GenericType  string
+	SpecificType string
+	Other        string
+}
+
+// Error gets a human readable string describing this error.
+func (e errSelfReferentialType) Error() string {
+	if e.Other == "" {
+		return "Type set replaces generic type '" + e.GenericType + "' with itself"
+	}
+	return "Specific type '" + e.SpecificType + "' for generic type '" + e.GenericType + "' has generic type '" + e.Other + "' in it, which would be replaced too"
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errSelfReferentialType) Is(target error) bool {
+	return target == ErrBadTypeSets
+}
+
 type errBadTypeArgs struct {
 	Message string
 	Arg     string
@@ -44,4 +408,31 @@ func (e errBadTypeArgs) Error() string {
 	return "\"" + e.Arg + "\" is bad: " + e.Message
 }
 
+// Is gets whether target is the kind of error this is.
+func (e errBadTypeArgs) Is(target error) bool {
+	return target == ErrBadTypeSets
+}
+
+// errBadTypeSetsFile represents an error when a file of type sets can't
+// be used. Index is the type set that is wrong, or -1 if the whole file
+// is.
+type errBadTypeSetsFile struct {
+	Filename string
+	Index    int
+	Message  string
+}
+
+// Error gets a human readable string describing this error.
+func (e errBadTypeSetsFile) Error() string {
+	if e.Index < 0 {
+		return "\"" + e.Filename + "\" is bad: " + e.Message
+	}
+	return "\"" + e.Filename + "\" is bad: type set " + strconv.Itoa(e.Index) + ": " + e.Message
+}
+
+// Is gets whether target is the kind of error this is.
+func (e errBadTypeSetsFile) Is(target error) bool {
+	return target == ErrBadTypeSets
+}
+
 var errMissingTypeInformation = errors.New("No type arguments were specified and no \"// +gogen\" tag was found in the source.")
@@ -0,0 +1,89 @@
+package parse
+
+import (
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GenericsFile generates the code for the type sets from the source file
+// at srcPath and saves it to dstPath, making its directory if need be.
+//
+// If pkgName is empty the generated code goes in the package of the
+// other Go files in the destination directory (see DirPackageName), or
+// keeps the package of the source if there are none. Its imports are
+// resolved relative to dstPath.
+func GenericsFile(srcPath, dstPath, pkgName string, typeSets []map[string]string) error {
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return &errSource{Err: err}
+	}
+	defer in.Close()
+
+	if pkgName == "" {
+		if pkgName, err = DirPackageName(filepath.Dir(dstPath), dstPath); err != nil {
+			return err
+		}
+	}
+	output, err := GenericsWithOptions(srcPath, in, typeSets, Options{PkgName: pkgName, OutFilename: dstPath})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dstPath, output, 0644)
+}
+
+// DirPackageName gets the package the Go files in the directory are in,
+// from the first of them (by name) that can be parsed. Tests, files left
+// out of the build by their build constraints or names (like a
+// //go:build ignore helper in package main) and the file named by
+// exclude (like a file about to be generated again) are ignored.
+// It gets an empty string if there are no Go files in the directory, or
+// it doesn't exist.
+func DirPackageName(dir, exclude string) (string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if exclude != "" && sameFile(filepath.Join(dir, name), exclude) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if match, err := build.Default.MatchFile(dir, name); err != nil || !match {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err == nil {
+			return file.Name.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// sameFile gets whether the paths are of the same file.
+func sameFile(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
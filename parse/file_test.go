@@ -0,0 +1,77 @@
+package parse_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joelrahman/genny/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericsFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "genny")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, code string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(code), 0644))
+	}
+	write("queues.go", "package queues\n")
+	write("queues_test.go", "package queues_test\n")
+	write("int_queue.go", "package stale\n")
+
+	src, _ := filepath.Abs("test/queue/generic_queue.go")
+	dst := filepath.Join(dir, "int_queue.go")
+	typeSets := []map[string]string{{"Something": "int"}}
+	if assert.NoError(t, parse.GenericsFile(src, dst, "", typeSets)) {
+		out, _ := ioutil.ReadFile(dst)
+		assert.Contains(t, string(out), "package queues\n")
+		assert.Contains(t, string(out), "type IntQueue struct")
+	}
+
+	// the package given wins, and directories are made
+	dst = filepath.Join(dir, "sub", "int_queue.go")
+	if assert.NoError(t, parse.GenericsFile(src, dst, "ints", typeSets)) {
+		out, _ := ioutil.ReadFile(dst)
+		assert.Contains(t, string(out), "package ints\n")
+	}
+
+	// imports are resolved like those of the files where it is saved
+	write("sub/models.go", "package ints\n\nimport \"ourco/internal/models\"\n\nvar _ models.Thing\n")
+	if assert.NoError(t, parse.GenericsFile(src, dst, "", []map[string]string{{"Something": "models.Thing"}})) {
+		out, _ := ioutil.ReadFile(dst)
+		assert.Contains(t, string(out), "import \"ourco/internal/models\"\n")
+	}
+
+	// or like those of the files in ImportsDir
+	code, _ := ioutil.ReadFile(src)
+	out, err := parse.GenericsWithOptions("embedded/generic_queue.go", bytes.NewReader(code), []map[string]string{{"Something": "models.Thing"}}, parse.Options{
+		ImportsDir: filepath.Join(dir, "sub"),
+	})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "import \"ourco/internal/models\"\n")
+	}
+
+	name, err := parse.DirPackageName(filepath.Join(dir, "missing"), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+
+	// files that aren't built are ignored
+	write("sub/aaa_gen.go", "//go:build ignore\n\npackage main\n")
+	write("sub/aab_old.go", "// +build ignore\n\npackage main\n")
+	name, err = parse.DirPackageName(filepath.Join(dir, "sub"), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ints", name)
+
+	err = parse.GenericsFile(filepath.Join(dir, "missing.go"), dst, "", typeSets)
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "Failed to parse source file: "))
+	}
+
+}
@@ -0,0 +1,66 @@
+package parse
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// Generator generates the code for a template, for programs (like ones
+// run by go generate) that generate many files without building the
+// arguments of Generics themselves.
+//
+//	g := parse.NewGenerator("generic_queue.go", nil)
+//	g.SetPackage("queues")
+//	g.AddTypeSet(map[string]string{"Item": "int"})
+//	g.AddTypeSet(map[string]string{"Item": "string"})
+//	err := g.Generate(w)
+type Generator struct {
+	// Options control how the code is generated. SetPackage sets their
+	// PkgName.
+	Options Options
+
+	filename string
+	source   []byte
+	typeSets []map[string]string
+}
+
+// NewGenerator makes a Generator for the template in the source, or in
+// the file if source is nil (which is read when the code is generated).
+func NewGenerator(filename string, source []byte) *Generator {
+	return &Generator{filename: filename, source: source}
+}
+
+// AddTypeSet adds a type set (the specific types for each generic type)
+// to generate the code for, after the ones already added.
+func (g *Generator) AddTypeSet(typeSet map[string]string) {
+	set := make(map[string]string, len(typeSet))
+	for generic, specific := range typeSet {
+		set[generic] = specific
+	}
+	g.typeSets = append(g.typeSets, set)
+}
+
+// SetPackage sets the package of the generated code, which is the package
+// of the template if it is never set.
+func (g *Generator) SetPackage(pkgName string) {
+	g.Options.PkgName = pkgName
+}
+
+// Generate generates the code for every type set added and writes it to
+// w. Nothing is written if the code can't be generated.
+func (g *Generator) Generate(w io.Writer) error {
+	src := g.source
+	if src == nil {
+		var err error
+		if src, err = ioutil.ReadFile(g.filename); err != nil {
+			return &errSource{Err: err}
+		}
+	}
+	output, err := GenericsWithOptions(g.filename, bytes.NewReader(src), g.typeSets, g.Options)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(output)
+	return err
+}
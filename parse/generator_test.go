@@ -0,0 +1,47 @@
+package parse_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/joelrahman/genny/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerator(t *testing.T) {
+
+	g := parse.NewGenerator("test/queue/generic_queue.go", nil)
+	g.SetPackage("queues")
+	typeSet := map[string]string{"Something": "int"}
+	g.AddTypeSet(typeSet)
+	typeSet["Something"] = "string"
+	g.AddTypeSet(typeSet)
+
+	var out bytes.Buffer
+	if assert.NoError(t, g.Generate(&out)) {
+		assert.Contains(t, out.String(), "package queues\n")
+		assert.Contains(t, out.String(), "type IntQueue struct")
+		assert.Contains(t, out.String(), "type StringQueue struct")
+	}
+
+	g = parse.NewGenerator("generic_queue.go", []byte(contents(`test/queue/generic_queue.go`)))
+	g.AddTypeSet(map[string]string{"Something": "int"})
+	g.Options.Editable = true
+	out.Reset()
+	if assert.NoError(t, g.Generate(&out)) {
+		assert.Contains(t, out.String(), "package queue\n")
+		assert.NotContains(t, out.String(), "Any changes will be lost")
+	}
+
+	g = parse.NewGenerator("test/queue/missing.go", nil)
+	out.Reset()
+	err := g.Generate(&out)
+	if assert.Error(t, err) {
+		assert.True(t, errors.Is(err, parse.ErrSource))
+		assert.True(t, strings.HasPrefix(err.Error(), "Failed to parse source file: "))
+	}
+	assert.Equal(t, 0, out.Len())
+
+}
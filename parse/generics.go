@@ -0,0 +1,559 @@
+package parse
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// typeParamConstraints maps the generic placeholder types to the
+// constraints their type parameters get.
+var typeParamConstraints = map[string]string{
+	"Type":    "any",
+	"Number":  "Number",
+	"String":  "~string",
+	"Ordered": "Ordered",
+}
+
+// constraintDecls are the declarations of the constraints used by
+// typeParamConstraints that have to be added to the generated code.
+var constraintDecls = map[string]string{
+	"Number": `// Number is a constraint that permits any number type.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+`,
+	"Signed": `// Signed is a constraint that permits any signed integer type.
+type Signed interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+`,
+	"Unsigned": `// Unsigned is a constraint that permits any unsigned integer type.
+type Unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+`,
+	"Integer": `// Integer is a constraint that permits any integer type.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+`,
+	"Float": `// Float is a constraint that permits any floating-point type.
+type Float interface {
+	~float32 | ~float64
+}
+`,
+	"Ordered": `// Ordered is a constraint that permits any type that supports the
+// operators < <= >= >.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+`,
+}
+
+// numberConstraints are the constraints a generic.Number type parameter
+// can get, narrowest first, with the types each permits.
+var numberConstraints = []struct {
+	name  string
+	types []string
+}{
+	{"Signed", []string{"int", "int8", "int16", "int32", "int64", "rune"}},
+	{"Unsigned", []string{"uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte"}},
+	{"Integer", []string{"int", "int8", "int16", "int32", "int64", "rune", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte"}},
+	{"Float", []string{"float32", "float64"}},
+}
+
+// numberConstraint gets the narrowest constraint that permits every one
+// of the specific types, which is Number if there are none or any of
+// them isn't a built-in integer or float type.
+func numberConstraint(specificTypes []string) string {
+	if len(specificTypes) == 0 {
+		return "Number"
+	}
+	for _, c := range numberConstraints {
+		permits := true
+		for _, specificType := range specificTypes {
+			permits = permits && containsString(c.types, specificType)
+		}
+		if permits {
+			return c.name
+		}
+	}
+	return "Number"
+}
+
+// GenericsGeneric parses the source file and generates a single copy of
+// the code that uses Go type parameters in place of the generic types,
+// rather than a copy for each specific type.
+//
+// Every top-level type and function that refers to a generic type (or to
+// another declaration that does) gets a type parameter named after the
+// generic type, constrained by its kind: generic.Type becomes any while
+// generic.Number becomes a Number constraint that is added to the
+// generated code. References to those declarations are instantiated
+// explicitly.
+func GenericsGeneric(filename, pkgName string, in io.ReadSeeker) ([]byte, error) {
+	return GenericsGenericFor(filename, pkgName, in, nil)
+}
+
+// GenericsGenericFor is like GenericsGeneric, but each generic.Number type
+// parameter gets the narrowest constraint that permits every specific
+// type the type sets give it: Signed, Unsigned, Integer or Float (like
+// Integer for int and uint8), or Number if none of them do.
+func GenericsGenericFor(filename, pkgName string, in io.ReadSeeker, typeSets []map[string]string) ([]byte, error) {
+	return GenericsGenericWithOptions(filename, in, typeSets, Options{PkgName: pkgName})
+}
+
+// GenericsGenericWithOptions is like GenericsGenericFor, as controlled by
+// the options. Only the options about the package, header, generic
+// package, imports and line endings apply to code with type parameters:
+// PkgName, Header, Editable, PackageDoc, GenericImportPath,
+// GenericPackageName, LocalPrefix, FormatOnly, OutFilename, ImportsDir
+// and CRLF.
+func GenericsGenericWithOptions(filename string, in io.ReadSeeker, typeSets []map[string]string, opts Options) ([]byte, error) {
+
+	// parse the source file
+	in.Seek(0, os.SEEK_SET)
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, &errSource{Err: err}
+	}
+	fs := token.NewFileSet()
+	file, err := parser.ParseFile(fs, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, &errSource{Err: err}
+	}
+
+	// find the generic types and take them out of the file
+	cmap := ast.NewCommentMap(fs, file, file.Comments)
+	importPath, pkg := opts.genericPackage()
+	genericName, _ := genericPackageNames(file, importPath, pkg)
+	params := make(map[ast.Spec]int)
+	var paramNames, constraintNames []string
+	var decls []ast.Decl
+	var removed []ast.Node
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if ok && gen.Tok == token.CONST {
+			for _, d := range genericDecls(&ast.File{Decls: []ast.Decl{gen}}, genericName, "") {
+				return nil, &errGenericsUnsupported{Name: d.Name, Reason: genericName + "." + d.Kind + " has no type parameter equivalent"}
+			}
+		}
+		if !ok || gen.Tok != token.TYPE {
+			decls = append(decls, decl)
+			continue
+		}
+		var specs []ast.Spec
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			kind, ok := genericKind(ts, genericName)
+			if !ok {
+				specs = append(specs, spec)
+				continue
+			}
+			constraint, ok := typeParamConstraints[kind]
+			if !ok {
+				return nil, &errGenericsUnsupported{Name: ts.Name.Name, Reason: genericName + "." + kind + " has no type parameter equivalent"}
+			}
+			if kind == "Number" {
+				var specificTypes []string
+				for _, typeSet := range typeSets {
+					if specificType, ok := typeSet[ts.Name.Name]; ok {
+						specificTypes = append(specificTypes, specificType)
+					}
+				}
+				constraint = numberConstraint(specificTypes)
+			}
+			params[ts] = len(paramNames)
+			paramNames = append(paramNames, ts.Name.Name)
+			constraintNames = append(constraintNames, constraint)
+			removed = append(removed, ts)
+		}
+		if len(specs) == 0 {
+			removed = append(removed, gen)
+			continue
+		}
+		gen.Specs = specs
+		decls = append(decls, gen)
+	}
+	file.Decls = decls
+	removeComments(file, cmap, removed)
+	if opts.PackageDoc != "" && file.Doc != nil {
+		removeComment(file, file.Doc)
+	}
+	if genericImport := findImport(file, importPath); genericImport != nil {
+		astutil.DeleteNamedImport(fs, file, importName(genericImport), importPath)
+	}
+
+	// work out which generic types each declaration needs
+	g := newGenericGraph(file, params)
+	if err := g.resolve(); err != nil {
+		return nil, err
+	}
+
+	// add the type parameters to the declarations and instantiate every
+	// reference to them
+	g.instantiate(paramNames)
+	usedConstraints := make(map[string]bool)
+	for _, e := range g.entities {
+		if len(e.params) == 0 {
+			continue
+		}
+		list := &ast.FieldList{}
+		for _, p := range e.sortedParams() {
+			usedConstraints[constraintNames[p]] = true
+			name := ast.NewIdent(paramNames[p])
+
+			// share the constraint with the previous parameter if it can
+			if n := len(list.List); n > 0 && list.List[n-1].Type.(*ast.Ident).Name == constraintNames[p] {
+				list.List[n-1].Names = append(list.List[n-1].Names, name)
+				continue
+			}
+			list.List = append(list.List, &ast.Field{
+				Names: []*ast.Ident{name},
+				Type:  ast.NewIdent(constraintNames[p]),
+			})
+		}
+		switch d := e.node.(type) {
+		case *ast.TypeSpec:
+			d.TypeParams = list
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				d.Type.TypeParams = list
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(opts.header(""))
+	if opts.PackageDoc != "" {
+		doc := &cleaner{opts: opts}
+		doc.writePackageDoc()
+		buf.Write(doc.out.Bytes())
+	}
+	if err := format.Node(&buf, fs, file); err != nil {
+		return nil, &errSource{Err: err}
+	}
+	var names []string
+	for name := range usedConstraints {
+		if _, ok := constraintDecls[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString("\n" + constraintDecls[name])
+	}
+
+	output := buf.Bytes()
+	if opts.PkgName != "" {
+		output = changePackage(bytes.NewReader(output), opts.PkgName)
+	}
+	formatted, err := opts.format(filename, output)
+	if err != nil {
+		return nil, &errImports{Err: err, Source: output}
+	}
+	if opts.CRLF {
+		formatted = CRLF(formatted)
+	}
+	return formatted, nil
+}
+
+// genericKind gets the name of placeholder type (like Type or Number) the
+// type spec declares a generic type with.
+func genericKind(ts *ast.TypeSpec, genericName string) (string, bool) {
+	sel, ok := ts.Type.(*ast.SelectorExpr)
+	if !ok {
+		return "", false
+	}
+	if x, ok := sel.X.(*ast.Ident); !ok || x.Name != genericName {
+		return "", false
+	}
+	return sel.Sel.Name, true
+}
+
+// findImport gets the import of the path in the file.
+func findImport(file *ast.File, path string) *ast.ImportSpec {
+	for _, imp := range file.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil && p == path {
+			return imp
+		}
+	}
+	return nil
+}
+
+// importName gets the name an import was given, if any.
+func importName(imp *ast.ImportSpec) string {
+	if imp.Name == nil {
+		return ""
+	}
+	return imp.Name.Name
+}
+
+// removeComment drops the comment from the file.
+func removeComment(file *ast.File, group *ast.CommentGroup) {
+	var comments []*ast.CommentGroup
+	for _, g := range file.Comments {
+		if g != group {
+			comments = append(comments, g)
+		}
+	}
+	file.Comments = comments
+	if file.Doc == group {
+		file.Doc = nil
+	}
+}
+
+// removeComments drops the comments that belong to the removed nodes.
+func removeComments(file *ast.File, cmap ast.CommentMap, removed []ast.Node) {
+	drop := make(map[*ast.CommentGroup]bool)
+	for _, n := range removed {
+		for _, group := range cmap[n] {
+			drop[group] = true
+		}
+	}
+	var comments []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if !drop[group] {
+			comments = append(comments, group)
+		}
+	}
+	file.Comments = comments
+}
+
+// genericEntity is a top-level declaration that might need type
+// parameters.
+type genericEntity struct {
+	node   ast.Node
+	name   string
+	direct map[int]bool
+	deps   []*genericEntity
+	params map[int]bool
+	method bool
+	value  bool
+}
+
+// sortedParams gets the indexes of the type parameters the entity needs,
+// in the order the generic types were declared.
+func (e *genericEntity) sortedParams() []int {
+	var ps []int
+	for p := range e.params {
+		ps = append(ps, p)
+	}
+	sort.Ints(ps)
+	return ps
+}
+
+// genericGraph records how the top-level declarations of a file refer to
+// each other and to the generic types.
+type genericGraph struct {
+	file     *ast.File
+	entities []*genericEntity
+	byObj    map[interface{}]*genericEntity
+	names    map[*ast.Ident]bool
+}
+
+// newGenericGraph finds the top-level declarations of the file and what
+// each of them refers to.
+func newGenericGraph(file *ast.File, params map[ast.Spec]int) *genericGraph {
+	g := &genericGraph{
+		file:  file,
+		byObj: make(map[interface{}]*genericEntity),
+		names: make(map[*ast.Ident]bool),
+	}
+	add := func(node ast.Node, decl interface{}, name *ast.Ident) *genericEntity {
+		e := &genericEntity{node: node, name: name.Name, direct: make(map[int]bool), params: make(map[int]bool)}
+		g.entities = append(g.entities, e)
+		if decl != nil {
+			g.byObj[decl] = e
+		}
+		g.names[name] = true
+		return e
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				add(d, d, d.Name)
+			} else {
+				add(d, nil, d.Name).method = true
+			}
+		case *ast.GenDecl:
+			// consts without a type or values repeat those of the last
+			// const before them that has them (like a group using iota)
+			var repeated *genericEntity
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add(s, s, s.Name)
+				case *ast.ValueSpec:
+					implicit := d.Tok == token.CONST && s.Type == nil && len(s.Values) == 0
+					for _, name := range s.Names {
+						e := add(s, s, name)
+						e.value = true
+						if implicit && repeated != nil {
+							e.deps = append(e.deps, repeated)
+						} else if !implicit {
+							repeated = e
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// find out what each declaration refers to
+	for _, e := range g.entities {
+		ast.Inspect(e.node, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok || ident.Obj == nil || g.names[ident] {
+				return true
+			}
+			if spec, ok := ident.Obj.Decl.(ast.Spec); ok {
+				if p, ok := params[spec]; ok {
+					e.direct[p] = true
+					return true
+				}
+			}
+			if dep, ok := g.byObj[ident.Obj.Decl]; ok && dep != e {
+				e.deps = append(e.deps, dep)
+			}
+			return true
+		})
+
+		// methods share the type parameters of their receiver type
+		if fn, ok := e.node.(*ast.FuncDecl); ok && e.method {
+			if recv := g.receiverType(fn); recv != nil {
+				recv.deps = append(recv.deps, e)
+				e.deps = append(e.deps, recv)
+			}
+		}
+	}
+	return g
+}
+
+// receiverType gets the entity of the type a method is declared on.
+func (g *genericGraph) receiverType(fn *ast.FuncDecl) *genericEntity {
+	if len(fn.Recv.List) == 0 {
+		return nil
+	}
+	expr := fn.Recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+			continue
+		case *ast.ParenExpr:
+			expr = e.X
+			continue
+		case *ast.Ident:
+			if e.Obj != nil {
+				return g.byObj[e.Obj.Decl]
+			}
+		}
+		return nil
+	}
+}
+
+// resolve works out the full set of type parameters for each declaration,
+// which includes those needed by the declarations it refers to.
+func (g *genericGraph) resolve() error {
+	g.propagate()
+	for _, e := range g.entities {
+		if e.value && len(e.params) > 0 {
+			return &errGenericsUnsupported{Name: e.name, Reason: "variables and constants can't have type parameters"}
+		}
+	}
+	return nil
+}
+
+// propagate works out which generic types each declaration refers to,
+// either directly or through the other declarations it refers to.
+func (g *genericGraph) propagate() {
+	for changed := true; changed; {
+		changed = false
+		for _, e := range g.entities {
+			for p := range e.direct {
+				if !e.params[p] {
+					e.params[p] = true
+					changed = true
+				}
+			}
+			for _, dep := range e.deps {
+				for p := range dep.params {
+					if !e.params[p] {
+						e.params[p] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// independentDecls gets the names of the top-level declarations in the
+// file that don't refer to any of the generic types declared by decls,
+// even through other declarations. Their names are left alone even if
+// they contain the name of a generic type.
+func independentDecls(file *ast.File, decls []genericDecl) map[string]bool {
+	params := make(map[ast.Spec]int)
+	for i, d := range decls {
+		params[d.spec] = i
+	}
+	g := newGenericGraph(file, params)
+	g.propagate()
+	independent := make(map[string]bool)
+	for _, e := range g.entities {
+		if spec, ok := e.node.(ast.Spec); ok {
+			if _, ok := params[spec]; ok {
+				continue
+			}
+		}
+		if !e.method && len(e.params) == 0 {
+			independent[e.name] = true
+		}
+	}
+	return independent
+}
+
+// instantiate adds type arguments to every reference to a declaration
+// that has type parameters.
+func (g *genericGraph) instantiate(paramNames []string) {
+	astutil.Apply(g.file, func(c *astutil.Cursor) bool {
+		ident, ok := c.Node().(*ast.Ident)
+		if !ok || ident.Obj == nil || g.names[ident] {
+			return true
+		}
+		if sel, ok := c.Parent().(*ast.SelectorExpr); ok && sel.Sel == ident {
+			return true
+		}
+		e, ok := g.byObj[ident.Obj.Decl]
+		if !ok || len(e.params) == 0 {
+			return true
+		}
+		var args []ast.Expr
+		for _, p := range e.sortedParams() {
+			args = append(args, ast.NewIdent(paramNames[p]))
+		}
+		if len(args) == 1 {
+			c.Replace(&ast.IndexExpr{X: ident, Index: args[0]})
+		} else {
+			c.Replace(&ast.IndexListExpr{X: ident, Indices: args})
+		}
+		return true
+	}, nil)
+}
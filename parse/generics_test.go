@@ -0,0 +1,216 @@
+package parse_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joelrahman/genny/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenericsGeneric(t *testing.T) {
+
+	for _, test := range []struct {
+		in          string
+		expectedOut string
+	}{
+		{
+			in: `test/queue/generic_queue.go`,
+			expectedOut: `// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package queue
+
+// SomethingQueue is a queue of Somethings.
+type SomethingQueue[Something any] struct {
+	items []Something
+}
+
+func NewSomethingQueue[Something any]() *SomethingQueue[Something] {
+	return &SomethingQueue[Something]{items: make([]Something, 0)}
+}
+func (q *SomethingQueue[Something]) Push(item Something) {
+	q.items = append(q.items, item)
+}
+func (q *SomethingQueue[Something]) Pop() Something {
+	item := q.items[0]
+	q.items = q.items[1:]
+	return item
+}
+`,
+		},
+		{
+			in: `test/multipletypes/generic_simplemap.go`,
+			expectedOut: `// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package multipletypes
+
+type KeyTypeValueTypeMap[KeyType, ValueType any] map[KeyType]ValueType
+
+func (m KeyTypeValueTypeMap[KeyType, ValueType]) Has(key KeyType) bool {
+	_, ok := m[key]
+	return ok
+}
+
+func (m KeyTypeValueTypeMap[KeyType, ValueType]) Get(key KeyType) ValueType {
+	return m[key]
+}
+
+func (m KeyTypeValueTypeMap[KeyType, ValueType]) Set(key KeyType, value ValueType) KeyTypeValueTypeMap[KeyType, ValueType] {
+	m[key] = value
+	return m
+}
+`,
+		},
+		{
+			in: `test/numbers/generic_number.go`,
+			expectedOut: `// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package numbers
+
+func NumberTypeMax[NumberType Number](a, b NumberType) NumberType {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Number is a constraint that permits any number type.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+`,
+		},
+	} {
+		out, err := parse.GenericsGeneric("generic.go", "", strings.NewReader(contents(test.in)))
+		if assert.NoError(t, err, test.in) {
+			assert.Equal(t, test.expectedOut, string(out), test.in)
+		}
+	}
+
+}
+
+func TestGenericsGenericUsesDependencies(t *testing.T) {
+
+	src := `package things
+
+import "github.com/joelrahman/genny/generic"
+
+type Thing generic.Type
+
+type Box struct {
+	thing Thing
+}
+
+func (b Box) Get() Thing { return b.thing }
+
+func NewBox() Box { return Box{} }
+
+func Boxes(n int) []Box {
+	boxes := make([]Box, n)
+	for i := range boxes {
+		boxes[i] = NewBox()
+	}
+	return boxes
+}
+
+func Count() int { return 0 }
+
+var defaultThing Thing
+`
+
+	_, err := parse.GenericsGeneric("things.go", "", strings.NewReader(src))
+	assert.EqualError(t, err, "Cannot use type parameters for 'defaultThing': variables and constants can't have type parameters")
+
+	out, err := parse.GenericsGeneric("things.go", "", strings.NewReader(strings.Replace(src, "var defaultThing Thing\n", "", 1)))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "type Box[Thing any] struct {")
+		assert.Contains(t, string(out), "func (b Box[Thing]) Get() Thing")
+		assert.Contains(t, string(out), "func NewBox[Thing any]() Box[Thing] { return Box[Thing]{} }")
+		assert.Contains(t, string(out), "func Boxes[Thing any](n int) []Box[Thing] {")
+		assert.Contains(t, string(out), "boxes[i] = NewBox[Thing]()")
+		assert.Contains(t, string(out), "func Count() int")
+	}
+
+}
+
+func TestGenericsGenericForNumbers(t *testing.T) {
+
+	in := contents(`test/numbers/generic_number.go`)
+	for _, test := range []struct {
+		specificTypes []string
+		constraint    string
+	}{
+		{nil, "Number"},
+		{[]string{"int", "int64"}, "Signed"},
+		{[]string{"uint8", "byte"}, "Unsigned"},
+		{[]string{"int", "uint64"}, "Integer"},
+		{[]string{"float32"}, "Float"},
+		{[]string{"int", "float64"}, "Number"},
+		{[]string{"int", "MyInt"}, "Number"},
+	} {
+		var typeSets []map[string]string
+		for _, specificType := range test.specificTypes {
+			typeSets = append(typeSets, map[string]string{"NumberType": specificType})
+		}
+		out, err := parse.GenericsGenericFor("generic.go", "", strings.NewReader(in), typeSets)
+		if assert.NoError(t, err, test.specificTypes) {
+			assert.Contains(t, string(out), "func NumberTypeMax[NumberType "+test.constraint+"](a, b NumberType) NumberType {", test.specificTypes)
+			assert.Contains(t, string(out), "\ntype "+test.constraint+" interface {\n", test.specificTypes)
+			assert.Equal(t, 1, strings.Count(string(out), " interface {\n"), test.specificTypes)
+		}
+	}
+
+}
+
+func TestGenericsGenericWithOptions(t *testing.T) {
+
+	in := `// Package boxes is the doc of the template.
+package boxes
+
+import (
+	"example.com/ourco/money"
+	"fmt"
+	"github.com/google/uuid"
+	"ourco/internal/generic"
+)
+
+type Item generic.Type
+
+type ItemBox struct {
+	Value Item
+	ID    uuid.UUID
+	Price money.Amount
+}
+
+func (b ItemBox) String() string {
+	return fmt.Sprint(b.Value)
+}
+`
+
+	out, err := parse.GenericsGenericWithOptions("generic_boxes.go", strings.NewReader(in), nil, parse.Options{
+		PkgName:           "things",
+		Header:            "// Code generated by us. DO NOT EDIT.",
+		PackageDoc:        "Package things holds things.",
+		GenericImportPath: "ourco/internal/generic",
+		LocalPrefix:       "example.com/ourco",
+		CRLF:              true,
+	})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, strings.Replace(string(out), "\r\n", "", -1), "\n")
+		code := strings.Replace(string(out), "\r\n", "\n", -1)
+		assert.True(t, strings.HasPrefix(code, "// Code generated by us. DO NOT EDIT.\n\n// Package things holds things.\npackage things\n"), code)
+		assert.NotContains(t, code, "doc of the template")
+		assert.NotContains(t, code, "ourco/internal/generic")
+		assert.Contains(t, code, "\"github.com/google/uuid\"\n\n\t\"example.com/ourco/money\"\n")
+		assert.Contains(t, code, "type ItemBox[Item any] struct {")
+	}
+
+}
@@ -0,0 +1,103 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// hashPrefix starts the comment with the InputHash in generated headers.
+const hashPrefix = "// genny-hash: "
+
+// hashVersion starts everything that is hashed, and changes whenever what
+// is hashed does, so hashes from other versions of genny never match.
+const hashVersion = "genny-hash/2"
+
+// InputHash gets a hash of the source and the type sets it is generated
+// for with the default options. It is the same as InputHashWithOptions
+// with empty Options.
+func InputHash(src []byte, typeSets []map[string]string) string {
+	return InputHashWithOptions(src, typeSets, Options{})
+}
+
+// InputHashWithOptions gets a hash of the source, the type sets it is
+// generated for and the options that change the generated code, which is
+// put in the header of the generated code when the Hash option is set.
+// The same inputs always give the same hash, so tools can tell whether
+// code needs generating again without generating it. PostProcess can't be
+// hashed, so changing it isn't noticed.
+func InputHashWithOptions(src []byte, typeSets []map[string]string, opts Options) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n", hashVersion, len(src))
+	h.Write(src)
+	for _, typeSet := range typeSets {
+		h.Write([]byte("\x00"))
+		writeSorted(h, typeSet)
+	}
+	h.Write([]byte("\x00"))
+	for _, field := range opts.hashFields() {
+		h.Write([]byte(field + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashFields gets the options that change the generated code, always in
+// the same order. New options go on the end, and hashVersion changes if
+// any are removed or reordered.
+func (o Options) hashFields() []string {
+	ctypes := new(bytes.Buffer)
+	writeSorted(ctypes, o.CTypes)
+	return []string{
+		fmt.Sprintf("PkgName=%q", o.PkgName),
+		fmt.Sprintf("Strip=%q", o.Strip),
+		fmt.Sprintf("Header=%q", o.Header),
+		fmt.Sprintf("Editable=%t", o.Editable),
+		fmt.Sprintf("CTypes=%q", ctypes.String()),
+		fmt.Sprintf("KeepGoGenerate=%t", o.KeepGoGenerate),
+		fmt.Sprintf("StripGoGenerate=%q", o.StripGoGenerate),
+		fmt.Sprintf("GenericImportPath=%q", o.GenericImportPath),
+		fmt.Sprintf("GenericPackageName=%q", o.GenericPackageName),
+		fmt.Sprintf("StripPrefixes=%q", o.StripPrefixes),
+		fmt.Sprintf("FormatOnly=%t", o.FormatOnly),
+		fmt.Sprintf("LocalPrefix=%q", o.LocalPrefix),
+		fmt.Sprintf("KeepGenericDecls=%t", o.KeepGenericDecls),
+		fmt.Sprintf("CRLF=%t", o.CRLF),
+		fmt.Sprintf("OutFilename=%q", o.OutFilename),
+		fmt.Sprintf("ImportsDir=%q", o.ImportsDir),
+		fmt.Sprintf("IgnoreUnknownGenericTypes=%t", o.IgnoreUnknownGenericTypes),
+		fmt.Sprintf("PackageDoc=%q", o.PackageDoc),
+	}
+}
+
+// writeSorted writes the keys and values of the map in key order.
+func writeSorted(w io.Writer, m map[string]string) {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s=%s\n", k, m[k])
+	}
+}
+
+// ReadHash gets the InputHash from the header of generated code, or an
+// empty string if it hasn't got one.
+func ReadHash(code []byte) string {
+	sc := bufio.NewScanner(bytes.NewReader(code))
+	for sc.Scan() {
+		l := sc.Text()
+		if strings.HasPrefix(l, hashPrefix) {
+			return strings.TrimSpace(l[len(hashPrefix):])
+		}
+		if strings.HasPrefix(l, "package ") {
+			break
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package parse
+
+import (
+	"bytes"
+	"go/scanner"
+	"go/token"
+)
+
+// literal records where a comment, string or rune literal sits in the
+// source.
+type literal struct {
+	start, end int
+	tok        token.Token
+}
+
+// literals are all the comments, string and rune literals in a source
+// file, in the order they appear.
+type literals []literal
+
+// scanLiterals tokenizes the source and records where each comment,
+// string and rune literal starts and ends.
+func scanLiterals(filename string, src []byte) literals {
+	var lits literals
+	fs := token.NewFileSet()
+	file := fs.AddFile(filename, -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.COMMENT && tok != token.STRING && tok != token.CHAR {
+			continue
+		}
+		start := file.Offset(pos)
+		// the scanner strips carriage returns from raw strings and
+		// block comments, so find their real end in the source
+		end := start + len(lit)
+		switch {
+		case bytes.HasPrefix(src[start:], []byte("/*")):
+			end = start + bytes.Index(src[start:], []byte("*/")) + 2
+		case bytes.HasPrefix(src[start:], []byte("`")):
+			end = start + 1 + bytes.IndexByte(src[start+1:], '`') + 1
+		}
+		lits = append(lits, literal{start: start, end: end, tok: tok})
+	}
+	return lits
+}
+
+// inComment gets whether the offset falls inside a comment that started
+// before it.
+func (lits literals) inComment(offset int) bool {
+	for _, lit := range lits {
+		if lit.start >= offset {
+			break
+		}
+		if lit.tok == token.COMMENT && lit.end > offset {
+			return true
+		}
+	}
+	return false
+}
+
+// segments splits the line, which starts at offset in the source, into
+// alternating code and string or rune literal segments. The first
+// segment is always code (even if it is empty).
+func (lits literals) segments(l string, offset int) []string {
+	var segs []string
+	pos := 0
+	for _, lit := range lits {
+		if lit.end <= offset || lit.tok == token.COMMENT {
+			continue
+		}
+		start, end := lit.start-offset, lit.end-offset
+		if start >= len(l) {
+			break
+		}
+		if start < pos {
+			start = pos
+		}
+		if end > len(l) {
+			end = len(l)
+		}
+		segs = append(segs, l[pos:start], l[start:end])
+		pos = end
+	}
+	return append(segs, l[pos:])
+}
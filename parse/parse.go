@@ -3,14 +3,24 @@ package parse
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/tools/imports"
 )
@@ -25,6 +35,13 @@ var header = []byte(`
 
 `)
 
+var editableHeader = []byte(`
+
+// This file was automatically generated by genny.
+// see https://github.com/joelrahman/genny
+
+`)
+
 var ctypes = map[string]string{
 	"float64": "C.double",
 	"float32": "C.float",
@@ -34,160 +51,824 @@ var ctypes = map[string]string{
 	"uint32":  "C.uint",
 	"int64":   "C.long",
 	"uint64":  "C.ulong",
+	"int16":   "C.short",
+	"uint16":  "C.ushort",
+	"int8":    "C.schar",
+	"uint8":   "C.uchar",
+	"byte":    "C.uchar",
+	"bool":    "C._Bool",
+	// size_t is always known to cgo (unlike uintptr_t, which needs
+	// stdint.h) and is the size of a pointer on every platform Go runs on
+	"uintptr": "C.size_t",
 }
 
 var (
-	packageKeyword = []byte("package")
-	importKeyword  = []byte("import")
-	openBrace      = []byte("(")
-	closeBrace     = []byte(")")
-	space          = " "
-	genericPackage = "generic"
-	genericType    = "generic.Type"
-	genericNumber  = "generic.Number"
-	genericCType   = "cgeneric.CType"
-	genericCNumber = "cgeneric.CNumber"
-	linefeed       = "\r\n"
+	packageKeyword    = []byte("package")
+	importKeyword     = []byte("import")
+	openBrace         = []byte("(")
+	closeBrace        = []byte(")")
+	importC           = []byte(`import "C"`)
+	lineComment       = []byte("//")
+	blockCommentStart = []byte("/*")
+	blockCommentEnd   = []byte("*/")
+	genericPackage    = "generic"
+	cgenericPackage   = "cgeneric"
+	genericType       = "generic.Type"
+	genericNumber     = "generic.Number"
+	genericString     = "generic.String"
+	genericCType      = "cgeneric.CType"
+	genericCNumber    = "cgeneric.CNumber"
+
+	genericImportPath  = "github.com/joelrahman/genny/generic"
+	cgenericImportPath = "github.com/joelrahman/genny/generic/cgeneric"
+	testPackageSuffix  = "_test"
+	testFileSuffix     = "_test.go"
 )
+var goGeneratePrefix = []byte("//go:generate ")
+
 var unwantedLinePrefixes = [][]byte{
 	[]byte("//go:generate genny "),
 }
 
-func generateSpecific(filename string, in io.ReadSeeker, typeSet map[string]string, strip string) ([]byte, bool, error) {
-	usedC := false
+// source is a template that has been read and parsed once, ready to
+// generate the code for any number of type sets.
+type source struct {
+	filename string
+	code     []byte
+	fs       *token.FileSet
+	file     *ast.File
+
+	// genericName and cgenericName are what the generic packages are
+	// called in the file.
+	genericName  string
+	cgenericName string
+	decls        []genericDecl
+	independent  map[string]bool
+	// embedded are the generic types embedded in structs, whose fields
+	// are named after the specific type.
+	embedded map[string]bool
+	lines    []sourceLine
+	// declLines maps the first line of each declaration of generic types
+	// to its last line, so they can be left out.
+	declLines map[int]int
+	// keepDecls keeps the generic type declarations as comments.
+	keepDecls bool
+	// logReplacements logs the lines generic types are replaced in.
+	logReplacements bool
+	// ignoreUnknown leaves out the specific types of the generic types
+	// the source doesn't declare, rather than failing.
+	ignoreUnknown bool
+}
+
+// sourceLine is a line of the source, split into alternating code and
+// string or rune literal segments.
+type sourceLine struct {
+	segs            []string
+	startsInComment bool
+	endsInComment   bool
+	// directive is set if the line is a //genny: directive.
+	directive *directive
+}
+
+// parseSource reads and parses the source file.
+func parseSource(filename string, in io.ReadSeeker, opts Options) (*source, error) {
 	// ensure we are at the beginning of the file
 	in.Seek(0, os.SEEK_SET)
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, &errSource{Err: err}
+	}
 
 	// parse the source file
 	fs := token.NewFileSet()
-	file, err := parser.ParseFile(fs, filename, in, 0)
+	file, err := parser.ParseFile(fs, filename, src, 0)
 	if err != nil {
-		return nil, false, &errSource{Err: err}
+		return nil, &errSource{Err: err}
 	}
+	lits := scanLiterals(filename, src)
 
-	// make sure every generic.Type is represented in the types
-	// argument.
-	for _, decl := range file.Decls {
-		switch it := decl.(type) {
-		case *ast.GenDecl:
-			for _, spec := range it.Specs {
-				ts, ok := spec.(*ast.TypeSpec)
-				if !ok {
-					continue
-				}
-				switch tt := ts.Type.(type) {
-				case *ast.SelectorExpr:
-					if name, ok := tt.X.(*ast.Ident); ok {
-						if name.Name == genericPackage {
-							if _, ok := typeSet[ts.Name.Name]; !ok {
-								if ts.Name.Name[0] == 'C' {
-									if _, ok = typeSet[ts.Name.Name[1:]]; !ok {
-										return nil, false, &errMissingSpecificType{GenericType: ts.Name.Name}
-									}
-								}
-							}
-						}
+	// find out what the generic packages are called in this file
+	importPath, name := opts.genericPackage()
+	genericName, cgenericName := genericPackageNames(file, importPath, name)
+	s := &source{
+		filename:        filename,
+		code:            src,
+		fs:              fs,
+		file:            file,
+		genericName:     genericName,
+		cgenericName:    cgenericName,
+		decls:           genericDecls(file, genericName, cgenericName),
+		declLines:       make(map[int]int),
+		keepDecls:       opts.KeepGenericDecls,
+		logReplacements: opts.Log != nil && opts.LogReplacements,
+		ignoreUnknown:   opts.IgnoreUnknownGenericTypes,
+	}
+
+	// split the source into lines
+	tf := fs.File(file.Pos())
+	var open []*errBadDirective // the //genny:if blocks that haven't ended
+	offset := 0
+	for offset < len(src) {
+		end := bytes.IndexByte(src[offset:], '\n')
+		if end < 0 {
+			end = len(src) - offset
+		}
+		l := strings.TrimSuffix(string(src[offset:offset+end]), "\r")
+		sl := sourceLine{
+			segs:            lits.segments(l, offset),
+			startsInComment: lits.inComment(offset),
+			endsInComment:   lits.inComment(offset + end),
+		}
+
+		// keep track of the //genny:if blocks
+		if !sl.startsInComment {
+			pos := tf.Position(tf.Pos(offset))
+			if sl.directive, err = parseDirective(l, pos); err != nil {
+				return nil, err
+			}
+			if sl.directive != nil {
+				switch sl.directive.name {
+				case "if":
+					open = append(open, &errBadDirective{Directive: strings.TrimSpace(l), Position: pos, Reason: "missing //genny:endif"})
+				case "endif":
+					if len(open) == 0 {
+						return nil, &errBadDirective{Directive: strings.TrimSpace(l), Position: pos, Reason: "there is no //genny:if to end"}
 					}
+					open = open[:len(open)-1]
 				}
 			}
 		}
+		s.lines = append(s.lines, sl)
+		offset += end + 1
+	}
+	if len(open) > 0 {
+		return nil, open[len(open)-1]
 	}
 
-	// go back to the start of the file
-	in.Seek(0, os.SEEK_SET)
+	// add the generic types declared by //genny:type
+	for i, sl := range s.lines {
+		if sl.directive == nil || sl.directive.name != "type" {
+			continue
+		}
+		for _, name := range sl.directive.names {
+			if s.declares(name) {
+				continue
+			}
+			ts := findTypeSpec(file, name)
+			if ts == nil {
+				return nil, &errBadDirective{Directive: strings.TrimSpace(strings.Join(sl.segs, "")), Position: tf.Position(tf.LineStart(i + 1)), Reason: "there is no declaration of type " + name}
+			}
+			s.decls = append(s.decls, genericDecl{GenericParam: GenericParam{Name: name, Kind: "Type"}, spec: ts})
+		}
+	}
+	sort.SliceStable(s.decls, func(i, j int) bool { return s.decls[i].spec.Pos() < s.decls[j].spec.Pos() })
+
+	// find the lines to leave out, which are those of the generic type
+	// declarations (or the whole type ( ) block if it only has them)
+	specs := make(map[ast.Spec]bool, len(s.decls))
+	for _, d := range s.decls {
+		specs[d.spec] = true
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		var generic []ast.Node
+		for _, spec := range gen.Specs {
+			if specs[spec] {
+				generic = append(generic, spec)
+			}
+		}
+		if len(generic) > 0 && len(generic) == len(gen.Specs) {
+			generic = []ast.Node{gen}
+		}
+		for _, node := range generic {
+			s.declLines[tf.Line(node.Pos())-1] = tf.Line(node.End()) - 1
+		}
+	}
+	s.independent = independentDecls(file, s.decls)
+	s.embedded = embeddedGenerics(file, s.decls)
+
+	// find the declarations each //genny:skip-if applies to
+	for i, sl := range s.lines {
+		if sl.directive == nil || sl.directive.name != "skip-if" {
+			continue
+		}
+		sl.directive.end = -1
+		for _, decl := range file.Decls {
+			if line := tf.Line(decl.Pos()) - 1; line > i {
+				sl.directive.end = tf.Line(decl.End()) - 1
+				break
+			}
+		}
+		if sl.directive.end < 0 {
+			return nil, &errBadDirective{Directive: strings.TrimSpace(strings.Join(sl.segs, "")), Position: tf.Position(tf.LineStart(i + 1)), Reason: "there is no declaration after it to skip"}
+		}
+	}
+	return s, nil
+}
+
+// generate generates the code for a single type set.
+func (s *source) generate(typeSet map[string]string, r *replacer) (*specific, error) {
+	usedC := false
+
+	// make sure every type in the type set is for a generic type (which
+	// catches typos), unless the type set is shared with other sources
+	var unknown []string
+	for t := range typeSet {
+		if !s.declares(t) {
+			unknown = append(unknown, t)
+		}
+	}
+	if len(unknown) > 0 && s.ignoreUnknown {
+		known := make(map[string]string, len(typeSet))
+		for t, specificType := range typeSet {
+			if s.declares(t) {
+				known[t] = specificType
+			}
+		}
+		typeSet = known
+	} else if len(unknown) > 0 {
+		sort.Strings(unknown)
+		var declared []string
+		for _, d := range s.decls {
+			declared = append(declared, d.Name)
+		}
+		return nil, &errUnknownGenericType{GenericType: unknown[0], Declared: declared}
+	}
+
+	// make sure no specific type is (or has in it) a generic type that
+	// would be replaced again, which would depend on the order the types
+	// are replaced in
+	if err := checkReplacements(typeSet); err != nil {
+		return nil, err
+	}
+
+	// make sure every generic.Type is represented in the types
+	// argument.
+	var generics []string
+	var missing []errMissingSpecificType
+	for _, d := range s.decls {
+		generics = append(generics, d.Name)
+		if !hasSpecificType(typeSet, d.Name) {
+			missing = append(missing, errMissingSpecificType{GenericType: d.Name, Position: s.fs.Position(d.spec.Pos())})
+			continue
+		}
+		if specificType, ok := typeSet[d.Name]; ok && d.pkg == s.genericName {
+			if satisfies, ok := constraints[d.Kind]; ok && !satisfies(specificType) {
+				return nil, &errIncompatibleSpecificType{GenericType: d.Name, SpecificType: specificType, Kind: s.genericName + "." + d.Kind}
+			}
+		}
+
+		// a C type that takes its specific type from the Go one needs a C
+		// type to replace it with
+		if _, ok := typeSet[d.Name]; !ok && d.pkg == s.cgenericName {
+			if specificType := typeSet[d.Name[1:]]; r.ctypes[specificType] == "" {
+				return nil, &errUnsupportedCType{CType: d.Name, SpecificType: specificType}
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, &errMissingSpecificTypes{Missing: missing}
+	}
 
 	var buf bytes.Buffer
+	order := replaceOrder(typeSet) // the order the generic types are replaced in
+	used := make(map[string]bool)  // the generic types that were replaced
+	var log []string               // the lines to log about the replacements
 
-	comment := ""
-	scanner := bufio.NewScanner(in)
-	for scanner.Scan() {
+	var comment []string  // the lines of the comments waiting to be written
+	commentBlock := false // whether comment ends in an unfinished /* */ comment
+	var active []bool     // whether each //genny:if block we are in is generated
+	skipTo := -1          // the last line of a declaration being skipped
+	for n, sl := range s.lines {
+		if n <= skipTo {
+			continue
+		}
 
-		l := scanner.Text()
+		// leave out the //genny:if blocks that aren't for this type set
+		// and the declarations to skip
+		if d := sl.directive; d != nil {
+			switch d.name {
+			case "if":
+				active = append(active, d.cond.met(typeSet) && allActive(active))
+			case "endif":
+				active = active[:len(active)-1]
+			case "skip-if":
+				if d.cond.met(typeSet) && allActive(active) {
+					skipTo = d.end
+					comment = nil
+				}
+			}
+			continue
+		}
+		if !allActive(active) {
+			continue
+		}
 
-		// does this line contain generic.Type?
-		if strings.Contains(l, genericType) || strings.Contains(l, genericNumber) ||
-			strings.Contains(l, genericCType) || strings.Contains(l, genericCNumber) {
-			comment = ""
+		// leave out the generic type declarations, and their comments
+		if end, ok := s.declLines[n]; ok {
+			if s.keepDecls {
+				for _, decl := range s.lines[n : end+1] {
+					buf.WriteString(line(commentOut(strings.Join(decl.segs, ""))))
+				}
+			}
+			skipTo = end
+			comment = nil
 			continue
 		}
 
-		for t, specificType := range typeSet {
+		segs := append([]string(nil), sl.segs...)
+		original := strings.Join(segs, "")
 
-			// does the line contain our type
-			if strings.Contains(l, t) {
-
-				var newLine string
-				// check each word
-				for _, word := range strings.Fields(l) {
-
-					i := 0
-					for {
-						i = strings.Index(word[i:], t) // find out where
-
-						if i > -1 {
-
-							// if this isn't an exact match
-							if i > 0 && isAlphaNumeric(rune(word[i-1])) || i < len(word)-len(t) && isAlphaNumeric(rune(word[i+len(t)])) {
-								// replace the word with a capitolized version
-								if UseCType(word, t, i) {
-									word = strings.Replace(word, "C"+t, ctypes[specificType], 1)
-									usedC = true
-								} else {
-									trimmed := word
-									for {
-										periodIdx := strings.Index(trimmed, ".")
-										if periodIdx < 0 {
-											break
-										}
-										trimmed = trimmed[periodIdx+1:]
-									}
-									trimmed = strings.TrimLeft(trimmed, "*&(")
-									exported := unicode.IsUpper(rune(trimmed[0]))
-
-									word = strings.Replace(word, t, wordify(specificType, exported), 1)
-								}
-							} else {
-								// replace the word as is
-								word = strings.Replace(word, t, specificType, 1)
-							}
-
-							if (len(strip) > 0) && (i >= len(strip)) {
-								window := word[i-len(strip) : i]
-								if window == strip {
-									word = strings.Replace(word, strip, "", 1)
-									i = i - len(strip)
-								}
-							}
-						} else {
-							newLine = newLine + word + space
-							break
-						}
+		// replace the types everywhere but inside string and rune literals
+		for i := 0; i < len(segs); i += 2 {
+			for _, t := range order {
+				specificType := typeSet[t]
 
+				// Item(generic.Zero) is the zero value of the specific type
+				if zero := t + "(" + s.genericName + ".Zero)"; strings.Contains(segs[i], zero) {
+					segs[i] = strings.Replace(segs[i], zero, zeroValue(specificType), -1)
+					used[t] = true
+				}
+
+				// does the line contain our type
+				if mentionsGeneric(segs[i], t) {
+					replaced, c, err := r.identifiers(segs[i], t, specificType)
+					if err != nil {
+						return nil, err
 					}
+					used[t] = used[t] || replaced != segs[i]
+					segs[i] = replaced
+					usedC = usedC || c
 				}
-				l = newLine
 			}
 		}
-
-		if comment != "" {
-			buf.WriteString(line(comment))
-			comment = ""
+		l := strings.Join(segs, "")
+		if s.logReplacements && l != original {
+			log = append(log, fmt.Sprintf("%s:%d: %q becomes %q", s.filename, n+1, strings.TrimSpace(original), strings.TrimSpace(l)))
 		}
 
-		// is this line a comment?
-		// TODO: should we handle /* */ comments?
-		if strings.HasPrefix(l, "//") {
-			// record this line to print later
-			comment = l
+		// is this line a comment (or more of a /* */ comment)? The lines
+		// of a run of comments are kept until the line after them, as they
+		// are left out if it declares a generic type.
+		trimmed := strings.TrimLeft(l, " \t")
+		if commentBlock || strings.HasPrefix(trimmed, "//") || !sl.startsInComment && isBlockCommentLine(trimmed) {
+			comment = append(comment, l)
+			commentBlock = sl.endsInComment
 			continue
 		}
 
-		// write the line
+		// write the comments before the line, and the line
+		for _, c := range comment {
+			buf.WriteString(line(c))
+		}
+		comment = nil
 		buf.WriteString(line(l))
 	}
 
+	for _, c := range comment {
+		buf.WriteString(line(c))
+	}
+
+	var unused []string
+	for _, t := range order {
+		if !used[t] {
+			unused = append(unused, t)
+		}
+	}
+	sort.Strings(unused)
+
 	// write it out
-	return buf.Bytes(), usedC, nil
+	return &specific{code: buf.Bytes(), usedC: usedC, generics: generics, unused: unused, log: log}, nil
+}
+
+// declares gets whether the source declares the generic type, or a C
+// type that takes its specific type from it (see hasSpecificType).
+func (s *source) declares(genericType string) bool {
+	for _, d := range s.decls {
+		if d.Name == genericType || d.pkg == s.cgenericName && d.Name == "C"+genericType {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplacements gets an error for the first specific type (in order
+// of the generic types) that is its own generic type or has one of the
+// generic types of the type set in it.
+func checkReplacements(typeSet map[string]string) error {
+	generics := sortedKeys(typeSet)
+	for _, t := range generics {
+		specificType := typeSet[t]
+		if specificType == t {
+			return &errSelfReferentialType{GenericType: t, SpecificType: specificType}
+		}
+		for _, other := range generics {
+			if other != t && mentions(specificType, other) {
+				return &errSelfReferentialType{GenericType: t, SpecificType: specificType, Other: other}
+			}
+		}
+	}
+	return nil
+}
+
+// replaceOrder gets the generic types of the type set in the order they
+// are replaced in: longest first (then in order), so a generic type whose
+// name is part of another's (like Key in KeyValue) is replaced after it.
+func replaceOrder(typeSet map[string]string) []string {
+	order := sortedKeys(typeSet)
+	sort.SliceStable(order, func(i, j int) bool { return len(order[i]) > len(order[j]) })
+	return order
+}
+
+// sortedKeys gets the generic types of the type set in order.
+func sortedKeys(typeSet map[string]string) []string {
+	keys := make([]string, 0, len(typeSet))
+	for t := range typeSet {
+		keys = append(keys, t)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mentions gets whether the generic type t is in any of the identifiers of
+// the specific type, where it would be replaced.
+func mentions(specificType, t string) bool {
+	words := strings.FieldsFunc(specificType, func(r rune) bool { return !isAlphaNumeric(r) })
+	for _, word := range words {
+		for i := 0; i < len(word); {
+			j := strings.Index(word[i:], t)
+			if j < 0 {
+				break
+			}
+			if atWordBoundary(word, t, i+j) {
+				return true
+			}
+			i += j + len(t)
+		}
+	}
+	return false
+}
+
+// commentOut makes the line of code a // comment, after its indent.
+func commentOut(l string) string {
+	code := strings.TrimLeft(l, " \t")
+	return l[:len(l)-len(code)] + "// " + code
+}
+
+// findTypeSpec finds the top-level declaration of the named type.
+func findTypeSpec(file *ast.File, name string) *ast.TypeSpec {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+				return ts
+			}
+		}
+	}
+	return nil
+}
+
+// allActive gets whether every one of the blocks is generated.
+func allActive(active []bool) bool {
+	return len(active) == 0 || active[len(active)-1]
+}
+
+// hasSpecificType gets whether the type set has a specific type for the
+// generic type. C types (like CItem) can also take the specific type of
+// the generic type without the C (Item).
+func hasSpecificType(typeSet map[string]string, genericType string) bool {
+	if _, ok := typeSet[genericType]; ok {
+		return true
+	}
+	if strings.HasPrefix(genericType, "C") {
+		_, ok := typeSet[genericType[1:]]
+		return ok
+	}
+	return false
+}
+
+// embeddedGenerics finds the generic types that are embedded in a struct
+// (as Item or *Item).
+func embeddedGenerics(file *ast.File, decls []genericDecl) map[string]bool {
+	generic := make(map[string]bool, len(decls))
+	for _, d := range decls {
+		generic[d.Name] = true
+	}
+	embedded := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		st, ok := n.(*ast.StructType)
+		if !ok {
+			return true
+		}
+		for _, field := range st.Fields.List {
+			typ := field.Type
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			if ident, ok := typ.(*ast.Ident); ok && len(field.Names) == 0 && generic[ident.Name] {
+				embedded[ident.Name] = true
+			}
+		}
+		return true
+	})
+	return embedded
+}
+
+// isUnion gets whether the specific type is a list of types, like
+// int|string, for code that takes any of them. Unions are generated as
+// interface{} but named after every type in them (so IntOrString).
+func isUnion(specificType string) bool {
+	expr, err := parser.ParseExpr(specificType)
+	if err != nil {
+		return false
+	}
+	union, ok := expr.(*ast.BinaryExpr)
+	return ok && union.Op == token.OR
+}
+
+// needsParens gets whether the specific type has to be in brackets to be
+// converted to, like (*int)(v) or (func())(f), because it starts with an
+// operator or keyword.
+func needsParens(specificType string) bool {
+	return strings.HasPrefix(specificType, "*") || strings.HasPrefix(specificType, "<-") || strings.HasPrefix(specificType, "func")
+}
+
+// embeddedName gets the name of the field a specific type gets when it is
+// embedded in a struct, which is its name without its package, type
+// arguments or any *.
+func embeddedName(specificType string) string {
+	name := strings.TrimLeft(specificType, "*")
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// specific is the code generated from the source for a single type set.
+type specific struct {
+	code []byte
+	// usedC is whether the code needs import "C".
+	usedC bool
+	// generics are the names of the generic types declared in the source.
+	generics []string
+	// unused are the generic types of the type set that weren't replaced
+	// anywhere.
+	unused []string
+	// log are the lines to log about the replacements, if they are
+	// logged.
+	log []string
+}
+
+// replacer replaces the generic types in identifiers with specific types.
+type replacer struct {
+	// strip is a prefix to strip from in front of the generic types.
+	strip string
+	// keep are the identifiers that are never changed.
+	keep map[string]bool
+	// ctypes maps specific types to the C types they replace C types
+	// with.
+	ctypes map[string]string
+	// embedded are the generic types that are embedded in structs.
+	embedded map[string]bool
+	// packages are the names of the packages the source imports, whose
+	// identifiers (like testing.T) are never changed.
+	packages map[string]bool
+}
+
+// newReplacer makes a replacer for the source with the options.
+func newReplacer(src *source, opts Options) *replacer {
+	r := &replacer{strip: opts.Strip, keep: src.independent, ctypes: ctypes, embedded: src.embedded, packages: make(map[string]bool)}
+	for _, imp := range src.file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := packageName(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		r.packages[name] = true
+	}
+	if len(opts.CTypes) > 0 {
+		r.ctypes = make(map[string]string, len(ctypes)+len(opts.CTypes))
+		for k, v := range ctypes {
+			r.ctypes[k] = v
+		}
+		for k, v := range opts.CTypes {
+			r.ctypes[k] = v
+		}
+	}
+	return r
+}
+
+// identifiers replaces the generic type t wherever it appears in the
+// identifiers of s, leaving everything in between (including whitespace)
+// exactly as it was.
+func (r *replacer) identifiers(s, t, specificType string) (string, bool, error) {
+	usedC := false
+	last := "" // the identifier before this one
+	var out strings.Builder
+	for len(s) > 0 {
+		// copy anything that isn't part of an identifier
+		i := strings.IndexFunc(s, isAlphaNumeric)
+		if i < 0 {
+			out.WriteString(s)
+			break
+		}
+		out.WriteString(s[:i])
+		selector := strings.HasSuffix(s[:i], ".") && !strings.HasSuffix(s[:i], "...")
+		qualified := s[:i] == "." && r.packages[last]
+		s = s[i:]
+
+		// find the end of the identifier
+		i = strings.IndexFunc(s, func(r rune) bool { return !isAlphaNumeric(r) })
+		if i < 0 {
+			i = len(s)
+		}
+		word, c := s[:i], false
+		last = word
+		switch {
+		case qualified:
+			// the identifiers of imported packages are left alone
+		case word == t && r.embedded[t] && isName(out.String(), s[i:], t, selector):
+			// the field of an embedded generic type, as a selector or a
+			// key, which is named after the specific type without its
+			// package
+			word = embeddedName(specificType)
+		case word == t && strings.HasPrefix(s[i:], "(") && needsParens(specificType):
+			// a conversion, like Item(v), to a type like *int
+			word = "(" + specificType + ")"
+		case word == t && isName(out.String(), s[i:], t, selector):
+			// a field or variable named after the generic type
+			first, _ := utf8.DecodeRuneInString(t)
+			word = wordify(specificType, unicode.IsUpper(first))
+		case !r.keep[word]:
+			var err error
+			word, c, err = r.identifier(word, t, specificType)
+			if err != nil {
+				return "", false, err
+			}
+		}
+		out.WriteString(word)
+		usedC = usedC || c
+		s = s[i:]
+	}
+	return out.String(), usedC, nil
+}
+
+// identifier replaces every occurrence of the generic type t in the
+// identifier word.
+func (r *replacer) identifier(word, t, specificType string) (string, bool, error) {
+
+	// replace the word as is
+	if word == t {
+		if isUnion(specificType) {
+			return "interface{}", false, nil
+		}
+		return specificType, false, nil
+	}
+
+	if !mentionsGeneric(word, t) {
+		return word, false, nil
+	}
+
+	// replace the word with its C type
+	if i := strings.Index(word, t); UseCType(word, t, i) {
+		ctype, ok := r.ctypes[specificType]
+		if !ok {
+			return "", false, &errUnsupportedCType{CType: word[:i+len(t)], SpecificType: specificType}
+		}
+		return ctype + word[i+len(t):], true, nil
+	}
+
+	// replace the word with a capitolized version, unless it starts with
+	// the generic type and isn't exported
+	first, _ := utf8.DecodeRuneInString(word)
+	exported := unicode.IsUpper(first)
+
+	// an unexported generic type is also found capitalized, like secret in
+	// NewSecret
+	capitalized := capitalize(t)
+
+	var out strings.Builder
+	for {
+		i, found := strings.Index(word, t), t
+		if j := strings.Index(word, capitalized); j >= 0 && (i < 0 || j < i) {
+			i, found = j, capitalized
+		}
+		if i < 0 {
+			out.WriteString(word)
+			break
+		}
+		if !atWordBoundary(word, found, i) {
+			out.WriteString(word[:i+len(found)])
+			word = word[i+len(found):]
+			continue
+		}
+		prefix := word[:i]
+		if len(r.strip) > 0 && strings.HasSuffix(prefix, r.strip) {
+			prefix = prefix[:len(prefix)-len(r.strip)]
+		}
+		out.WriteString(prefix)
+		out.WriteString(wordify(specificType, exported || found != t || out.Len() > 0))
+		word = word[i+len(found):]
+	}
+	return out.String(), false, nil
+}
+
+// isName gets whether the generic type t, between the code before and
+// after it, is the name of something (like a field or key) rather than a
+// type: it is selected (x.Item), followed by a colon (Item: v) other than
+// in a case, or followed by itself as a type (Item Item or Item *Item).
+func isName(before, after, t string, selector bool) bool {
+	if selector {
+		return true
+	}
+	rest := strings.TrimLeft(after, " \t")
+	if strings.HasPrefix(rest, ":") {
+		return !strings.HasSuffix(strings.TrimRight(before, " \t"), "case")
+	}
+	if len(rest) == len(after) {
+		return false
+	}
+	typ := strings.TrimLeft(rest, "*[]")
+	if !strings.HasPrefix(typ, t) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(typ[len(t):])
+	return !isAlphaNumeric(next)
+}
+
+// mentionsGeneric gets whether s has the generic type t in it, or (for an
+// unexported generic type) its capitalized form.
+func mentionsGeneric(s, t string) bool {
+	return strings.Contains(s, t) || strings.Contains(s, capitalize(t))
+}
+
+// atWordBoundary gets whether the generic type t found at i in the
+// identifier word is a whole word of it (or its plural), so Item is found
+// in ItemList, NewItem and Items but not in Itemize.
+func atWordBoundary(word, t string, i int) bool {
+	if i > 0 {
+		before, _ := utf8.DecodeLastRuneInString(word[:i])
+		first, _ := utf8.DecodeRuneInString(t)
+		if unicode.IsLetter(before) && !unicode.IsUpper(first) {
+			return false
+		}
+	}
+	rest := word[i+len(t):]
+	if strings.HasPrefix(rest, "s") {
+		rest = rest[1:]
+	}
+	after, size := utf8.DecodeRuneInString(rest)
+	if utf8.RuneCountInString(t) == 1 && unicode.IsUpper(after) {
+		// a single letter is only a word before another word, so T is
+		// found in TStack but not in TODO or TTL
+		next, _ := utf8.DecodeRuneInString(rest[size:])
+		return unicode.IsLower(next)
+	}
+	return !unicode.IsLower(after)
+}
+
+// isBlockCommentLine gets whether the line is made up of nothing but
+// a /* */ comment, which may carry on to the following lines.
+func isBlockCommentLine(l string) bool {
+	if !strings.HasPrefix(l, "/*") {
+		return false
+	}
+	end := strings.Index(l[2:], "*/")
+	return end < 0 || strings.TrimSpace(l[end+4:]) == ""
+}
+
+// genericPackageNames gets the local names the generic and cgeneric
+// packages are imported as in the file, taking aliases into account. The
+// generic package is the one at importPath, called name when it isn't
+// aliased.
+func genericPackageNames(file *ast.File, importPath, name string) (string, string) {
+	genericName, cgenericName := name, cgenericPackage
+	for _, imp := range file.Imports {
+		if imp.Name == nil || imp.Name.Name == "_" || imp.Name.Name == "." {
+			continue
+		}
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		switch path {
+		case importPath:
+			genericName = imp.Name.Name
+		case cgenericImportPath:
+			cgenericName = imp.Name.Name
+		}
+	}
+	return genericName, cgenericName
 }
 
 func UseCType(word, t string, i int) bool {
@@ -200,97 +881,667 @@ func UseCType(word, t string, i int) bool {
 // Generics parses the source file and generates the bytes replacing the
 // generic types for the keys map with the specific types (its value).
 func Generics(filename, pkgName string, in io.ReadSeeker, typeSets []map[string]string, strip string) ([]byte, error) {
+	return GenericsWithOptions(filename, in, typeSets, Options{PkgName: pkgName, Strip: strip})
+}
 
-	totalOutput := header
-	needC := false
-	for _, typeSet := range typeSets {
+// GenericsBytes is like Generics for a template held in memory, like one
+// embedded with go:embed. The filename is only used in errors and to
+// resolve the imports of the generated code, so the file doesn't need to
+// exist.
+func GenericsBytes(src []byte, filename, pkgName string, typeSets []map[string]string) ([]byte, error) {
+	return Generics(filename, pkgName, bytes.NewReader(src), typeSets, "")
+}
 
-		// generate the specifics
-		parsed, usedC, err := generateSpecific(filename, in, typeSet, strip)
-		if err != nil {
+// Options controls how the code is generated.
+type Options struct {
+	// PkgName is the package name for the generated code. The package
+	// name of the source file is kept if it is empty.
+	PkgName string
+	// Strip is a prefix to strip from type names.
+	Strip string
+	// Header is the comment to put at the top of the generated code in
+	// place of the default. It is written as is, so each line must be a
+	// Go comment.
+	Header string
+	// Editable leaves the note that changes will be lost out of the
+	// default header, for generated code that is meant to be edited.
+	Editable bool
+	// CTypes maps specific types to the C types that cgeneric.CType
+	// types become, on top of (or in place of) the built-in mapping.
+	CTypes map[string]string
+	// KeepGoGenerate keeps every //go:generate line of the source in the
+	// generated code. By default the ones that run genny are dropped so
+	// the generated code doesn't generate more code.
+	KeepGoGenerate bool
+	// StripGoGenerate, when set, drops the //go:generate lines that
+	// contain it instead of the ones that run genny.
+	StripGoGenerate string
+	// GenericImportPath is the import path of the package the generic
+	// types are declared with, for templates that use their own copy of
+	// the generic package. It is github.com/joelrahman/genny/generic if
+	// empty.
+	GenericImportPath string
+	// GenericPackageName is the name of the package at GenericImportPath,
+	// if it isn't the last element of the path.
+	GenericPackageName string
+	// StripPrefixes drops the lines of the source that start with any of
+	// them (like //genny:template-only) from the generated code, along
+	// with the lines genny always drops.
+	StripPrefixes []string
+	// FormatOnly formats the generated code with gofmt instead of
+	// goimports, so its imports are left as they are in the source (less
+	// the generic packages) rather than resolved. This keeps imports that
+	// goimports can't see are used, like those only used by code for
+	// other build tags.
+	FormatOnly bool
+	// LocalPrefix is a comma separated list of import path prefixes
+	// whose imports goimports puts in a group of their own, after the
+	// third party ones (like goimports -local).
+	LocalPrefix string
+	// PostProcess, if set, is given the formatted code to make any other
+	// changes to before it is returned. Any error it returns is returned
+	// as is.
+	PostProcess func([]byte) ([]byte, error)
+	// Hash adds a // genny-hash: comment with the InputHash of the source
+	// and type sets to the header, so tools can see when the code needs
+	// generating again (see ReadHash).
+	Hash bool
+	// KeepGenericDecls keeps the generic type declarations of the source
+	// in the generated code as comments (like // type Item generic.Type),
+	// to show what the code was generated from.
+	KeepGenericDecls bool
+	// Log, if set, is written a line about each generic type found in the
+	// source and each type set the code is generated for, to help work
+	// out why the generated code isn't what was expected.
+	Log io.Writer
+	// LogReplacements also logs every line generic types are replaced in
+	// to Log, before and after.
+	LogReplacements bool
+	// CRLF ends the lines of the generated code with \r\n instead of \n,
+	// after any PostProcess.
+	CRLF bool
+	// OutFilename, if set, is the path the generated code will be saved
+	// to, when it isn't the filename of the source. goimports resolves
+	// the imports of the generated code relative to it, like those of the
+	// package it goes in.
+	OutFilename string
+	// ImportsDir, if set, is the directory goimports resolves the imports
+	// of the generated code relative to, as if it were saved there, for
+	// when the filename of the source (like that of an embedded template)
+	// isn't a real path.
+	ImportsDir string
+	// PackageDoc, if set, is the package doc comment of the generated
+	// code, in place of the one above the package clause of the source.
+	// Its lines are made into // comments unless they are comments
+	// already.
+	PackageDoc string
+	// IgnoreUnknownGenericTypes skips the specific types of type sets for
+	// generic types the source doesn't declare, instead of failing with
+	// an ErrBadTypeSets error, for type sets shared by many templates.
+	IgnoreUnknownGenericTypes bool
+}
+
+// genericPackage gets the import path and name of the generic package.
+func (o Options) genericPackage() (string, string) {
+	if o.GenericImportPath == "" {
+		return genericImportPath, genericPackage
+	}
+	if o.GenericPackageName == "" {
+		return o.GenericImportPath, packageName(o.GenericImportPath)
+	}
+	return o.GenericImportPath, o.GenericPackageName
+}
+
+// isGenericImport gets whether the import path is of the generic package
+// (or genny's own, or a package inside either), which the generated code
+// never imports however the template imports it.
+func (o Options) isGenericImport(path string) bool {
+	genericPath, _ := o.genericPackage()
+	for _, p := range []string{genericPath, genericImportPath} {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// unwanted gets whether a line of the source should be left out of the
+// generated code.
+func (o Options) unwanted(l []byte) bool {
+	if bytes.HasPrefix(l, goGeneratePrefix) {
+		switch {
+		case o.KeepGoGenerate:
+			return false
+		case o.StripGoGenerate != "":
+			return bytes.Contains(l[len(goGeneratePrefix):], []byte(o.StripGoGenerate))
+		}
+	}
+	for _, prefix := range unwantedLinePrefixes {
+		if bytes.HasPrefix(l, prefix) {
+			return true
+		}
+	}
+	for _, prefix := range o.StripPrefixes {
+		if bytes.HasPrefix(l, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// format formats the generated code, fixing its imports (relative to
+// the OutFilename or ImportsDir, if there is one) unless FormatOnly is
+// set.
+func (o Options) format(filename string, src []byte) ([]byte, error) {
+	if o.OutFilename != "" {
+		filename = o.OutFilename
+	}
+	if o.ImportsDir != "" {
+		filename = filepath.Join(o.ImportsDir, filepath.Base(filename))
+	}
+	if o.FormatOnly {
+		return format.Source(src)
+	}
+	return processImports(filename, src, o.LocalPrefix)
+}
+
+// processImports fixes the imports of the code with goimports, grouping
+// those beginning with the local prefix (if there is one) after the
+// third party ones.
+func processImports(filename string, src []byte, localPrefix string) ([]byte, error) {
+
+	// goimports only takes the local prefix as a global, which every call
+	// reads
+	localPrefixLock.Lock()
+	defer localPrefixLock.Unlock()
+	defer func(prefix string) { imports.LocalPrefix = prefix }(imports.LocalPrefix)
+	imports.LocalPrefix = localPrefix
+	return imports.Process(filename, src, nil)
+}
+
+// localPrefixLock stops concurrent calls using each other's LocalPrefix.
+var localPrefixLock sync.Mutex
+
+// header gets the header to put at the top of the generated code, with
+// the input hash if there is one.
+func (o Options) header(hash string) []byte {
+	h := header
+	switch {
+	case o.Header != "":
+		h = []byte("\n\n" + strings.TrimRight(o.Header, "\r\n") + "\n\n")
+	case o.Editable:
+		h = editableHeader
+	}
+	if hash == "" {
+		return h
+	}
+
+	// the hash goes on the end of the header comment
+	comment := bytes.TrimRight(h, "\n")
+	return append(append([]byte(nil), comment...), "\n"+hashPrefix+hash+"\n\n"...)
+}
+
+// GenericsContext is like GenericsWithOptions but stops generating (and
+// returns the error of the context) as soon as the context is done.
+func GenericsContext(ctx context.Context, filename string, in io.ReadSeeker, typeSets []map[string]string, opts Options) ([]byte, error) {
+	res, err := generics(ctx, filename, in, typeSets, opts)
+	if err != nil {
+		return nil, err
+	}
+	return res.Code, nil
+}
+
+// GenericsWithOptions parses the source file and generates the bytes
+// replacing the generic types for the keys map with the specific types
+// (its value), as controlled by the options.
+func GenericsWithOptions(filename string, in io.ReadSeeker, typeSets []map[string]string, opts Options) ([]byte, error) {
+	res, err := generics(context.Background(), filename, in, typeSets, opts)
+	if err != nil {
+		return nil, err
+	}
+	return res.Code, nil
+}
+
+// GenericsTo parses the source file and writes the code generated for
+// each of the type sets to w.
+//
+// The type sets are generated at the same time, like Generics does, and
+// since goimports needs to see the whole file they are merged and
+// formatted in a single pass at the end. So all the generated code is held
+// in memory and written to w in one go, rather than streamed. Nothing is
+// written to w if generation fails.
+func GenericsTo(w io.Writer, filename, pkgName string, in io.ReadSeeker, typeSets []map[string]string, strip string) error {
+	res, err := generics(context.Background(), filename, in, typeSets, Options{PkgName: pkgName, Strip: strip})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(res.Code)
+	return err
+}
+
+// generics generates the code for all the type sets and describes what
+// it did.
+func generics(ctx context.Context, filename string, in io.ReadSeeker, typeSets []map[string]string, opts Options) (*GenericsResult, error) {
+
+	// work out what the specific types import
+	resolved, specificImports := qualifyTypeSets(typeSets)
+
+	src, err := parseSource(filename, in, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var hash string
+	if opts.Hash {
+		hash = InputHashWithOptions(src.code, typeSets, opts)
+	}
+	c := &cleaner{opts: opts, imports: specificImports}
+	c.clean(opts.header(hash))
+	declared := make(map[string]int)
+	declarations := make(map[string]string)
+	res := &GenericsResult{TypeSets: typeSets}
+
+	if opts.Log != nil {
+		for _, d := range src.decls {
+			kind := directivePrefix + "type"
+			if d.pkg != "" {
+				kind = d.pkg + "." + d.Kind
+			}
+			fmt.Fprintf(opts.Log, "%s: generic type %s (%s)\n", src.fs.Position(d.spec.Pos()), d.Name, kind)
+		}
+	}
+
+	// generate the specifics
+	specifics, err := generateAll(ctx, src, resolved, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, typeSet := range typeSets {
+		spec := specifics[i]
+		parsed := spec.code
+		res.Generics = spec.generics
+		if opts.Log != nil {
+			fmt.Fprintf(opts.Log, "%s: generating %s\n", filename, formatTypeSet(typeSet))
+			for _, l := range spec.log {
+				fmt.Fprintln(opts.Log, l)
+			}
+		}
+
+		// make sure no other type set generated something different
+		// with the same name
+		for name, code := range topLevelDecls(filename, parsed) {
+			if j, ok := declared[name]; ok && declarations[name] != code {
+				return nil, &errNameCollision{Name: name, TypeSet: typeSet, OtherTypeSet: typeSets[j]}
+			}
+			declared[name] = i
+			declarations[name] = code
+		}
+
+		c.needC = c.needC || spec.usedC
+		c.clean(parsed)
+		res.Unused = append(res.Unused, spec.unused)
+
+	}
+
+	// drop anything that was generated more than once
+	output, duplicates := dedupeDecls(filename, c.bytes())
+
+	// fix the imports
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	formatted, err := opts.format(filename, output)
+	if err != nil {
+		return nil, &errImports{Err: err, Source: output}
+	}
+	output = formatted
+	if opts.PostProcess != nil {
+		if output, err = opts.PostProcess(output); err != nil {
 			return nil, err
 		}
+	}
+	if opts.CRLF {
+		output = CRLF(output)
+	}
+
+	res.Code = output
+	res.NeedC = c.needC
+	res.Duplicates = duplicates
+	res.Decls = countDecls(filename, output)
+	res.Package, res.Names = declNames(filename, output)
+	if file, err := parser.ParseFile(token.NewFileSet(), filename, output, parser.ImportsOnly); err == nil {
+		genericPath, _ := opts.genericPackage()
+		sourceImports := importPaths(src.file, genericPath, cgenericImportPath)
+		res.Imports = importPaths(file)
+		res.AddedImports = diffImports(res.Imports, sourceImports)
+		res.RemovedImports = diffImports(sourceImports, res.Imports)
+	}
+	return res, nil
+}
 
-		needC = needC || usedC
-		totalOutput = append(totalOutput, parsed...)
+// generateAll generates the code for each of the type sets at the same
+// time, giving the results in the same order as the type sets.
+func generateAll(ctx context.Context, src *source, typeSets []map[string]string, opts Options) ([]*specific, error) {
+	r := newReplacer(src, opts)
+	specifics := make([]*specific, len(typeSets))
+	errs := make([]error, len(typeSets))
+	limit := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i := range typeSets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			if errs[i] = ctx.Err(); errs[i] != nil {
+				return
+			}
+			specifics[i], errs[i] = src.generate(typeSets[i], r)
+		}(i)
+	}
+	wg.Wait()
 
+	// report the error of the first type set that failed
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
+	return specifics, nil
+}
 
-	// clean up the code line by line
-	packageFound := false
-	insideImportBlock := false
-	packageNumber := 0
-	var cleanOutputLines []string
-	scanner := bufio.NewScanner(bytes.NewReader(totalOutput))
+// cleaner merges the code generated for each type set into a single
+// file, dropping the repeated package clauses and imports.
+type cleaner struct {
+	opts    Options
+	needC   bool
+	imports []importSpec
+
+	out               bytes.Buffer
+	sourceImports     []importSpec
+	groupedC          bool
+	placedC           bool
+	preambleEnd       int
+	commentStart      int
+	insideComment     bool
+	inCommentRun      bool
+	constraints       []string
+	goGenerates       map[string]bool
+	packageFound      bool
+	packageEnd        int
+	insideImportBlock bool
+	packageNumber     int
+}
+
+// clean cleans up the code line by line and adds it to the output.
+func (c *cleaner) clean(code []byte) {
+	c.collectImports(code)
+	scanner := bufio.NewScanner(bytes.NewReader(code))
+	beforePackage := true
 	for scanner.Scan() {
 
-		// end of imports block?
-		if insideImportBlock {
+		// build constraints are hoisted to the top of the file
+		if beforePackage && isBuildConstraint(scanner.Text()) {
+			c.addConstraint(scanner.Text())
+			continue
+		}
+
+		// the leading comments of the source are only kept once
+		if beforePackage && c.packageFound && !bytes.HasPrefix(scanner.Bytes(), packageKeyword) {
+			continue
+		}
+
+		// the imports are all merged into one block, so they are
+		// dropped from where they were
+		if c.insideImportBlock {
 			if bytes.HasSuffix(scanner.Bytes(), closeBrace) {
-				insideImportBlock = false
-			}
-			if packageNumber > 1 {
-				continue
+				c.insideImportBlock = false
 			}
+			continue
 		}
 
 		if bytes.HasPrefix(scanner.Bytes(), packageKeyword) {
-			packageNumber++
-			if packageFound {
+			beforePackage = false
+			c.packageNumber++
+			if c.packageFound {
+				c.inCommentRun = false
 				continue
-			} else {
-				packageFound = true
 			}
+			c.packageFound = true
+			if c.opts.PackageDoc != "" {
+				c.writePackageDoc()
+			}
+
+			// change package name
+			l := scanner.Text()
+			if c.opts.PkgName != "" {
+				l = string(changePackage(strings.NewReader(l), c.opts.PkgName))
+			}
+			c.out.WriteString(line(l))
+			c.packageEnd = c.out.Len()
+			continue
 		} else if bytes.HasPrefix(scanner.Bytes(), importKeyword) {
-			if bytes.HasSuffix(scanner.Bytes(), openBrace) {
-				insideImportBlock = true
+			isImportC := bytes.Equal(bytes.TrimSpace(scanner.Bytes()), importC)
+
+			// import "C" has to go straight after the preamble of the
+			// import it is dropped from
+			if c.packageNumber == 1 && !isImportC && c.inCommentRun && isCgoPreamble(c.out.Bytes()[c.commentStart:]) {
+				c.preambleEnd = c.out.Len()
 			}
-			if packageNumber > 1 {
+
+			// the preamble is only kept above the first type set's import
+			// "C", so it isn't left behind by the others
+			if c.packageNumber > 1 && c.inCommentRun && isCgoPreamble(c.out.Bytes()[c.commentStart:]) {
+				c.out.Truncate(c.commentStart)
+				c.inCommentRun = false
+			}
+
+			if bytes.HasSuffix(scanner.Bytes(), openBrace) {
+				c.insideImportBlock = true
 				continue
 			}
-		}
 
-		// check all unwantedLinePrefixes - and skip them
-		skipline := false
-		for _, prefix := range unwantedLinePrefixes {
-			if bytes.HasPrefix(scanner.Bytes(), prefix) {
-				skipline = true
+			// a lone import "C" stays below its cgo preamble
+			if !isImportC || c.packageNumber > 1 {
 				continue
 			}
+			c.placedC = true
 		}
 
-		if skipline {
+		// skip the lines that aren't wanted in the generated code
+		if c.opts.unwanted(scanner.Bytes()) {
 			continue
 		}
 
-		cleanOutputLines = append(cleanOutputLines, line(scanner.Text()))
-		if packageFound && needC {
-			cleanOutputLines = append(cleanOutputLines, "import \"C\"\n")
-			needC = false
+		// a //go:generate line is only kept once, so go generate doesn't
+		// run it for every type set
+		if bytes.HasPrefix(scanner.Bytes(), goGeneratePrefix) {
+			if c.goGenerates[scanner.Text()] {
+				continue
+			}
+			if c.goGenerates == nil {
+				c.goGenerates = make(map[string]bool)
+			}
+			c.goGenerates[scanner.Text()] = true
 		}
 
+		c.trackComments(scanner.Bytes())
+		c.out.WriteString(line(scanner.Text()))
+
 	}
+}
 
-	cleanOutput := strings.Join(cleanOutputLines, "")
+// writePackageDoc writes the PackageDoc comment, in place of the comment
+// directly above the package clause if there is one.
+func (c *cleaner) writePackageDoc() {
+	if c.inCommentRun {
+		c.out.Truncate(c.commentStart)
+	}
+	for _, l := range strings.Split(strings.TrimRight(c.opts.PackageDoc, "\r\n"), "\n") {
+		if trimmed := strings.TrimSpace(l); !strings.HasPrefix(trimmed, "//") && !strings.HasPrefix(trimmed, "/*") && !c.insideComment {
+			l = strings.TrimRight("// "+l, " \r")
+		}
+		c.trackComments([]byte(l))
+		c.out.WriteString(line(l))
+	}
+	c.inCommentRun = false
+}
 
-	output := []byte(cleanOutput)
+// trackComments keeps track of the run of comment lines the line is part
+// of, if any, before it is written to the output.
+func (c *cleaner) trackComments(l []byte) {
+	l = bytes.TrimSpace(l)
+	comment := c.insideComment || bytes.HasPrefix(l, lineComment) || bytes.HasPrefix(l, blockCommentStart)
+	if c.insideComment || bytes.HasPrefix(l, blockCommentStart) {
+		c.insideComment = !bytes.Contains(l, blockCommentEnd)
+	}
+	if comment && !c.inCommentRun {
+		c.commentStart = c.out.Len()
+	}
+	c.inCommentRun = comment
+}
 
-	// change package name
-	if pkgName != "" {
-		output = changePackage(bytes.NewReader([]byte(output)), pkgName)
+// isCgoPreamble gets whether the comment looks like a cgo preamble, which
+// has C preprocessor directives (like #include or #cgo) in it.
+func isCgoPreamble(comment []byte) bool {
+	for _, l := range bytes.Split(comment, []byte("\n")) {
+		l = bytes.TrimSpace(l)
+		l = bytes.TrimPrefix(l, lineComment)
+		l = bytes.TrimPrefix(l, blockCommentStart)
+		if bytes.HasPrefix(bytes.TrimSpace(l), []byte("#")) {
+			return true
+		}
 	}
-	// fix the imports
-	var err error
-	output, err = imports.Process(filename, output, nil)
+	return false
+}
 
+// collectImports records the imports of the code so they can be merged
+// with those of the other type sets. A lone import "C" is left where it
+// is.
+func (c *cleaner) collectImports(code []byte) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, parser.ImportsOnly)
 	if err != nil {
-		return nil, &errImports{Err: err}
+		return
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			imp := spec.(*ast.ImportSpec)
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil {
+				continue
+			}
+			if path == "C" {
+				c.groupedC = c.groupedC || gen.Lparen.IsValid()
+				continue
+			}
+			if c.opts.isGenericImport(path) {
+				continue
+			}
+			c.sourceImports = addImport(c.sourceImports, importSpec{Name: importName(imp), Path: path})
+		}
 	}
-	return output, nil
 }
 
+// addImport adds the import to the imports, unless it is already there.
+func addImport(imports []importSpec, imp importSpec) []importSpec {
+	for _, existing := range imports {
+		if existing == imp {
+			return imports
+		}
+	}
+	return append(imports, imp)
+}
+
+// addConstraint records a build constraint line, unless an earlier type
+// set already had it.
+func (c *cleaner) addConstraint(l string) {
+	for _, existing := range c.constraints {
+		if existing == l {
+			return
+		}
+	}
+	c.constraints = append(c.constraints, l)
+}
+
+// isBuildConstraint gets whether the line is a //go:build or // +build
+// constraint.
+func isBuildConstraint(l string) bool {
+	return strings.HasPrefix(l, "//go:build ") || strings.HasPrefix(l, "// +build ")
+}
+
+// bytes gets the cleaned up code, adding the imports needed by the
+// specific types (and import "C" if any type set needed it) straight
+// after the package clause, and any build constraints at the very top.
+func (c *cleaner) bytes() []byte {
+	output := c.withImports()
+	if len(c.constraints) == 0 {
+		return output
+	}
+	var constraints bytes.Buffer
+	for _, l := range c.constraints {
+		constraints.WriteString(line(l))
+	}
+	constraints.WriteString("\n")
+	return append(constraints.Bytes(), output...)
+}
+
+// withImports gets the cleaned up code with a single block of the imports
+// from every type set, and those needed by the specific types, added.
+func (c *cleaner) withImports() []byte {
+	output := c.out.Bytes()
+	imports := c.sourceImports
+	for _, imp := range c.imports {
+		imports = addImport(imports, imp)
+	}
+	if !c.packageFound || !c.needC && !c.groupedC && len(imports) == 0 {
+		return output
+	}
+	// the imports are kept apart from the package clause, which gofmt
+	// doesn't do when it has a comment
+	var extra bytes.Buffer
+	if len(imports) > 0 {
+		extra.WriteString("\nimport (\n")
+		for _, imp := range imports {
+			extra.WriteString(line("\t" + strings.TrimPrefix(imp.String(), "import ")))
+		}
+		extra.WriteString(")\n")
+	}
+	// a lone import "C" in the source is kept, so it isn't added again
+	needC := (c.needC || c.groupedC) && !c.placedC
+	if needC && c.preambleEnd == 0 {
+		if extra.Len() == 0 {
+			extra.WriteString("\n")
+		}
+		extra.WriteString("import \"C\"\n")
+	}
+	withImports := make([]byte, 0, len(output)+extra.Len()+len(importC)+1)
+	withImports = append(withImports, output[:c.packageEnd]...)
+	withImports = append(withImports, extra.Bytes()...)
+	if !needC || c.preambleEnd == 0 {
+		return append(withImports, output[c.packageEnd:]...)
+	}
+
+	// import "C" goes under its preamble
+	withImports = append(withImports, output[c.packageEnd:c.preambleEnd]...)
+	withImports = append(withImports, line(string(importC))...)
+	return append(withImports, output[c.preambleEnd:]...)
+}
+
+// CRLF changes the \n line endings of the code to \r\n, leaving any that
+// are \r\n already.
+func CRLF(code []byte) []byte {
+	return bytes.Replace(bytes.Replace(code, []byte("\r\n"), []byte("\n"), -1), []byte("\n"), []byte("\r\n"), -1)
+}
+
+// line ends the line with a \n, in place of the \n or \r\n it might end
+// with already.
 func line(s string) string {
-	return fmt.Sprintln(strings.TrimRight(s, linefeed))
+	return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r") + "\n"
 }
 
 // isAlphaNumeric gets whether the rune is alphanumeric or _.
@@ -300,16 +1551,121 @@ func isAlphaNumeric(r rune) bool {
 
 // wordify turns a type into a nice word for function and type
 // names etc.
+//
+// Composite types are named after the types they are made of, so []byte
+// becomes ByteSlice, map[string]int becomes StringIntMap and chan int
+// becomes IntChan, as are unions (int|string becomes IntOrString).
+// Instantiated generic types are named after the type and its type
+// arguments (Option[string] becomes OptionString). Pointers, dots and
+// braces are dropped.
 func wordify(s string, exported bool) string {
+	if expr, err := parser.ParseExpr(s); err == nil {
+		if words := typeWords(expr); len(words) > 0 {
+			s = words[0]
+			for _, word := range words[1:] {
+				s += capitalize(word)
+			}
+		}
+	}
 	s = strings.TrimRight(s, "{}")
 	s = strings.TrimLeft(s, "*&")
 	s = strings.Replace(s, ".", "", -1)
 	if !exported {
 		return s
 	}
+	return capitalize(s)
+}
+
+// typeWords breaks a type expression down into the words used to name
+// it. Nothing is returned for expressions that aren't types.
+func typeWords(expr ast.Expr) []string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return []string{e.Name}
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok {
+			return []string{x.Name + e.Sel.Name}
+		}
+	case *ast.StarExpr:
+		return typeWords(e.X)
+	case *ast.IndexExpr:
+		return typeArgWords(e.X, e.Index)
+	case *ast.IndexListExpr:
+		return typeArgWords(e.X, e.Indices...)
+	case *ast.ParenExpr:
+		return typeWords(e.X)
+	case *ast.BinaryExpr:
+		x, y := typeWords(e.X), typeWords(e.Y)
+		if e.Op == token.OR && len(x) > 0 && len(y) > 0 {
+			return append(append(x, "Or"), y...)
+		}
+	case *ast.ArrayType:
+		elt := typeWords(e.Elt)
+		if e.Len == nil {
+			return join(elt, "Slice")
+		}
+		if l, ok := e.Len.(*ast.BasicLit); ok && len(elt) > 0 {
+			return join(elt, "Array", l.Value)
+		}
+	case *ast.MapType:
+		key, value := typeWords(e.Key), typeWords(e.Value)
+		if len(key) > 0 && len(value) > 0 {
+			return join(append(key, value...), "Map")
+		}
+	case *ast.ChanType:
+		return join(typeWords(e.Value), "Chan")
+	case *ast.StructType:
+		if e.Fields == nil || len(e.Fields.List) == 0 {
+			return []string{"empty", "Struct"}
+		}
+		return []string{"struct"}
+	case *ast.InterfaceType:
+		return []string{"interface"}
+	case *ast.FuncType:
+		return []string{"func"}
+	}
+	return nil
+}
+
+// typeArgWords gets the words used to name an instantiated generic type,
+// which are those of the type followed by those of its type arguments
+// (so Pair[string, int] becomes PairStringInt).
+func typeArgWords(x ast.Expr, args ...ast.Expr) []string {
+	words := typeWords(x)
+	for _, arg := range args {
+		argWords := typeWords(arg)
+		if len(argWords) == 0 {
+			return nil
+		}
+		words = append(words, argWords...)
+	}
+	return words
+}
+
+// join adds the suffixes to the words, unless there are no words.
+func join(words []string, suffixes ...string) []string {
+	if len(words) == 0 {
+		return nil
+	}
+	return append(words, suffixes...)
+}
+
+// capitalize makes the first letter of s upper case.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
 	return strings.ToUpper(string(s[0])) + s[1:]
 }
 
+// packageClause matches a package clause, capturing what comes before
+// the name of the package and the name.
+var packageClause = regexp.MustCompile(`^(package\s+)([\p{L}_][\p{L}\p{N}_]*)`)
+
+// changePackage changes the name of the package in the first package
+// clause of the code, leaving the spacing and any comment after it as
+// they were. An external test package (like foo_test) stays a test
+// package.
 func changePackage(r io.Reader, pkgName string) []byte {
 	var out bytes.Buffer
 	sc := bufio.NewScanner(r)
@@ -318,10 +1674,12 @@ func changePackage(r io.Reader, pkgName string) []byte {
 	for sc.Scan() {
 		s := sc.Text()
 
-		if !done && strings.HasPrefix(s, "package") {
-			parts := strings.Split(s, " ")
-			parts[1] = pkgName
-			s = strings.Join(parts, " ")
+		if m := packageClause.FindStringSubmatch(s); !done && m != nil {
+			name := pkgName
+			if strings.HasSuffix(m[2], testPackageSuffix) && !strings.HasSuffix(name, testPackageSuffix) {
+				name += testPackageSuffix
+			}
+			s = packageClause.ReplaceAllString(s, "${1}"+name)
 			done = true
 		}
 
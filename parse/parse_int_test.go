@@ -1,6 +1,12 @@
 package parse
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,3 +39,1371 @@ func TestWordify(t *testing.T) {
 	}
 
 }
+
+func TestWordifyCompositeTypes(t *testing.T) {
+
+	for _, test := range []struct {
+		word       string
+		exported   string
+		unexported string
+	}{
+		{"[]byte", "ByteSlice", "byteSlice"},
+		{"[]*MyType", "MyTypeSlice", "MyTypeSlice"},
+		{"[16]byte", "ByteArray16", "byteArray16"},
+		{"map[string]int", "StringIntMap", "stringIntMap"},
+		{"map[string][]int", "StringIntSliceMap", "stringIntSliceMap"},
+		{"chan int", "IntChan", "intChan"},
+		{"<-chan int", "IntChan", "intChan"},
+		{"*os.File", "OsFile", "osFile"},
+		{"[]os.File", "OsFileSlice", "osFileSlice"},
+		{"struct{}", "EmptyStruct", "emptyStruct"},
+		{"interface{}", "Interface", "interface"},
+		{"int|string", "IntOrString", "intOrString"},
+		{"int|*os.File|[]byte", "IntOrOsFileOrByteSlice", "intOrOsFileOrByteSlice"},
+		{"Option[string]", "OptionString", "OptionString"},
+		{"*Pair[string, []byte]", "PairStringByteSlice", "PairStringByteSlice"},
+		{"[]result.Result[int]", "ResultResultIntSlice", "resultResultIntSlice"},
+	} {
+		assert.Equal(t, test.exported, wordify(test.word, true), test.word)
+		assert.Equal(t, test.unexported, wordify(test.word, false), test.word)
+	}
+
+}
+
+func TestGenericOrderedRejectsUnorderedTypes(t *testing.T) {
+
+	src := `package ordered
+
+import "github.com/joelrahman/genny/generic"
+
+type Key generic.Ordered
+
+func Less(a, b Key) bool { return a < b }
+`
+
+	for _, specific := range []string{"bool", "complex128", "error", "struct{}", "[]int", "map[string]int"} {
+		_, err := Generics("generic_ordered.go", "", strings.NewReader(src), []map[string]string{{"Key": specific}}, "")
+		if assert.IsType(t, &errIncompatibleSpecificType{}, err, specific) {
+			assert.Equal(t, "generic.Ordered", err.(*errIncompatibleSpecificType).Kind)
+		}
+	}
+	for _, specific := range append(Numbers, "string", "byte", "rune", "MyInt") {
+		_, err := Generics("generic_ordered.go", "", strings.NewReader(src), []map[string]string{{"Key": specific}}, "")
+		assert.NoError(t, err, specific)
+	}
+
+}
+
+func TestReplaceIdentifiersKeepsWhitespace(t *testing.T) {
+
+	for in, out := range map[string]string{
+		"\tvar x Something":                        "\tvar x int",
+		"\titems  []Something\t// the Somethings":  "\titems  []int\t// the Ints",
+		"func (q *SomethingQueue) Pop() Something": "func (q *IntQueue) Pop() int",
+		"\t\treturn &SomethingQueue{}  ":           "\t\treturn &IntQueue{}  ",
+	} {
+		actual, _, _ := (&replacer{}).identifiers(in, "Something", "int")
+		assert.Equal(t, out, actual)
+	}
+
+}
+
+func TestGenericStringRejectsNonStrings(t *testing.T) {
+
+	src := `package strings
+
+import "github.com/joelrahman/genny/generic"
+
+type Text generic.String
+
+func Len(t Text) int { return len(t) }
+`
+
+	for _, specific := range []string{"int", "float64", "bool", "[]byte", "*Name"} {
+		_, err := Generics("generic_string.go", "", strings.NewReader(src), []map[string]string{{"Text": specific}}, "")
+		if assert.Error(t, err, specific) {
+			assert.IsType(t, &errIncompatibleSpecificType{}, err)
+		}
+	}
+	for _, specific := range []string{"string", "Name"} {
+		_, err := Generics("generic_string.go", "", strings.NewReader(src), []map[string]string{{"Text": specific}}, "")
+		assert.NoError(t, err, specific)
+	}
+
+}
+
+func TestDedupeDecls(t *testing.T) {
+
+	src := `package dedupe
+
+func helper() {}
+
+// IntThing is an int thing.
+func IntThing() int { return 0 }
+
+// helper does nothing.
+func helper() {}
+
+func (m M) Get() {}
+
+func (m M) Get() {}
+`
+
+	out, dropped := dedupeDecls("dedupe.go", []byte(src))
+	assert.Equal(t, []string{"helper", "M.Get"}, dropped)
+	assert.Equal(t, `package dedupe
+
+func helper() {}
+
+// IntThing is an int thing.
+func IntThing() int { return 0 }
+
+func (m M) Get() {}
+`, string(out))
+
+}
+
+func TestNameCollisionsBetweenTypeSets(t *testing.T) {
+
+	src := `package collide
+
+import "github.com/joelrahman/genny/generic"
+
+type Thing generic.Type
+
+func NewThing() *Thing { return new(Thing) }
+`
+
+	_, err := Generics("collide.go", "", strings.NewReader(src), []map[string]string{{"Thing": "Bar"}, {"Thing": "*Bar"}}, "")
+	if assert.IsType(t, &errNameCollision{}, err) {
+		assert.Equal(t, "NewBar", err.(*errNameCollision).Name)
+		assert.Equal(t, `Type sets "Thing=Bar" and "Thing=*Bar" both generate 'NewBar'`, err.Error())
+	}
+
+	_, err = Generics("collide.go", "", strings.NewReader(src), []map[string]string{{"Thing": "Bar"}, {"Thing": "Baz"}}, "")
+	assert.NoError(t, err)
+
+}
+
+func TestUnnamedDeclsDontCollide(t *testing.T) {
+
+	src := `package boxes
+
+import (
+	"fmt"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+type ItemBox struct{ v Item }
+
+func (b ItemBox) String() string { return fmt.Sprint(b.v) }
+
+var _ fmt.Stringer = ItemBox{}
+
+var registry []fmt.Stringer
+
+func init() {
+	registry = append(registry, ItemBox{})
+}
+`
+
+	out, err := Generics("generic_boxes.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "var _ fmt.Stringer = IntBox{}\n")
+		assert.Contains(t, string(out), "var _ fmt.Stringer = StringBox{}\n")
+		assert.Contains(t, string(out), "\tregistry = append(registry, IntBox{})\n")
+		assert.Contains(t, string(out), "\tregistry = append(registry, StringBox{})\n")
+	}
+
+}
+
+func TestQualifyType(t *testing.T) {
+
+	for _, test := range []struct {
+		specific string
+		expected string
+		imports  []importSpec
+	}{
+		{"int", "int", nil},
+		{"time.Duration", "time.Duration", nil},
+		{"github.com/google/uuid.UUID", "uuid.UUID", []importSpec{{Path: "github.com/google/uuid"}}},
+		{"*github.com/google/uuid.UUID", "*uuid.UUID", []importSpec{{Path: "github.com/google/uuid"}}},
+		{"[]gopkg.in/yaml.v2.Node", "[]yaml.Node", []importSpec{{Name: "yaml", Path: "gopkg.in/yaml.v2"}}},
+		{"github.com/x/thing/v2.Thing", "thing.Thing", []importSpec{{Name: "thing", Path: "github.com/x/thing/v2"}}},
+		{"github.com/x/go-thing.Thing", "thing.Thing", []importSpec{{Name: "thing", Path: "github.com/x/go-thing"}}},
+		{"map[example.com/a.Key]example.com/b.Value", "map[a.Key]b.Value", []importSpec{{Path: "example.com/a"}, {Path: "example.com/b"}}},
+	} {
+		specific, imports := qualifyType(test.specific)
+		assert.Equal(t, test.expected, specific, test.specific)
+		assert.Equal(t, test.imports, imports, test.specific)
+	}
+
+	assert.Equal(t, `import "example.com/a"`, importSpec{Path: "example.com/a"}.String())
+	assert.Equal(t, `import yaml "gopkg.in/yaml.v2"`, importSpec{Name: "yaml", Path: "gopkg.in/yaml.v2"}.String())
+
+}
+
+func TestMissingSpecificTypesAreAllReported(t *testing.T) {
+
+	src := `package pairs
+
+import "github.com/joelrahman/genny/generic"
+
+type KeyType generic.Type
+type ValueType generic.Type
+type Extra generic.Number
+
+type Pair struct {
+	Key   KeyType
+	Value ValueType
+	Extra Extra
+}
+`
+
+	_, err := Generics("generic_pair.go", "", strings.NewReader(src), []map[string]string{{"ValueType": "int"}}, "")
+	if assert.Error(t, err) {
+		if assert.IsType(t, &errMissingSpecificTypes{}, err) {
+			missing := err.(*errMissingSpecificTypes).Missing
+			if assert.Len(t, missing, 2) {
+				assert.Equal(t, "KeyType", missing[0].GenericType)
+				assert.Equal(t, "Extra", missing[1].GenericType)
+			}
+		}
+		assert.Equal(t, "generic_pair.go:5:6: Missing specific type for 'KeyType' generic type\ngeneric_pair.go:7:6: Missing specific type for 'Extra' generic type", err.Error())
+		var perr PositionError
+		if assert.True(t, errors.As(err, &perr)) {
+			assert.Equal(t, "generic_pair.go:5:6", perr.Pos().String())
+		}
+	}
+
+}
+
+func TestReplaceOnlyWholeWordsOfGenericType(t *testing.T) {
+
+	src := `package items
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// ItemList is a list of names that has nothing to do with Item.
+type ItemList []string
+
+// ItemBox holds Items.
+type ItemBox struct {
+	items []Item
+	names ItemList
+}
+
+func (b *ItemBox) Itemize() ItemList { return b.names }
+`
+
+	out, err := Generics("generic_items.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "type ItemList []string")
+		assert.Contains(t, string(out), "// IntBox holds Ints.\ntype IntBox struct {\n\titems []int\n\tnames ItemList\n}")
+		assert.Contains(t, string(out), "func (b *IntBox) Itemize() ItemList")
+	}
+
+}
+
+func TestCTypesOption(t *testing.T) {
+
+	src := `package cthings
+
+import (
+	"github.com/joelrahman/genny/generic"
+	"github.com/joelrahman/genny/generic/cgeneric"
+)
+
+type Item generic.Type
+type CItem cgeneric.CType
+
+func ItemToC(v Item) CItem { return CItem(v) }
+`
+
+	out, err := GenericsWithOptions("generic_cthings.go", strings.NewReader(src), []map[string]string{{"Item": "bool"}, {"Item": "int"}}, Options{
+		CTypes: map[string]string{"bool": "C._Bool", "int": "C.longlong"},
+	})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "import \"C\"")
+		assert.Contains(t, string(out), "func BoolToC(v bool) C._Bool { return C._Bool(v) }")
+		assert.Contains(t, string(out), "func IntToC(v int) C.longlong { return C.longlong(v) }")
+	}
+
+	out, err = Generics("generic_cthings.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "func IntToC(v int) C.int { return C.int(v) }")
+	}
+
+	_, err = Generics("generic_cthings.go", "", strings.NewReader(src), []map[string]string{{"Item": "string"}}, "")
+	if assert.Error(t, err) {
+		assert.Equal(t, &errUnsupportedCType{CType: "CItem", SpecificType: "string"}, err)
+		assert.Equal(t, "Specific type 'string' has no C type to use for 'CItem' (it can be given in the CTypes option)", err.Error())
+	}
+
+}
+
+func TestConditionalBlocks(t *testing.T) {
+
+	src := `package blocks
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+//genny:if String
+func StringOnly() {}
+	//genny:if Number
+	func Never() {}
+	//genny:endif
+//genny:endif
+`
+
+	out, err := Generics("generic_blocks.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "StringOnly")
+		assert.NotContains(t, string(out), "Never")
+		assert.NotContains(t, string(out), "genny:")
+	}
+
+	out, err = Generics("generic_blocks.go", "", strings.NewReader(src), []map[string]string{{"Item": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "StringOnly")
+		assert.NotContains(t, string(out), "Never")
+	}
+
+	for bad, msg := range map[string]string{
+		"//genny:if Strange\n//genny:endif": "generic_bad.go:2:1: Bad directive '//genny:if Strange': 'Strange' is not a kind of type",
+		"//genny:endif":                     "generic_bad.go:2:1: Bad directive '//genny:endif': there is no //genny:if to end",
+		"//genny:if Number\n":               "generic_bad.go:2:1: Bad directive '//genny:if Number': missing //genny:endif",
+	} {
+		_, err := Generics("generic_bad.go", "", strings.NewReader("package bad\n"+bad), []map[string]string{{"Item": "int"}}, "")
+		if assert.Error(t, err, bad) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+
+}
+
+func TestSkipIfDirective(t *testing.T) {
+
+	src := `package skip
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+type ItemList []Item
+
+// Sum adds up the Items in the list.
+//genny:skip-if String
+func (l ItemList) Sum() (total Item) {
+	for _, v := range l {
+		total += v
+	}
+	return total
+}
+
+// Len gets the number of Items in the list.
+func (l ItemList) Len() int { return len(l) }
+`
+
+	out, err := Generics("generic_skip.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "func (l IntList) Sum() (total int) {")
+		assert.NotContains(t, string(out), "func (l StringList) Sum()")
+		assert.NotContains(t, string(out), "adds up the Strings")
+		assert.Contains(t, string(out), "// Len gets the number of Strings in the list.\nfunc (l StringList) Len() int")
+		assert.NotContains(t, string(out), "genny:")
+	}
+
+	_, err = Generics("generic_skip.go", "", strings.NewReader("package skip\n\n//genny:skip-if String\n"), []map[string]string{{"Item": "int"}}, "")
+	if assert.Error(t, err) {
+		assert.Equal(t, "generic_skip.go:3:1: Bad directive '//genny:skip-if String': there is no declaration after it to skip", err.Error())
+	}
+
+}
+
+func TestTypeDirective(t *testing.T) {
+
+	src := `package sets
+
+//genny:type Item Other
+
+// Item is what is in the set.
+type Item interface{}
+
+type (
+	Other interface{}
+	Named string
+)
+
+// ItemSet is a set of Items.
+type ItemSet map[Item]Other
+
+// Hello doesn't use the generic types.
+func Hello() Named { return "Item" }
+`
+
+	out, err := Generics("generic_sets.go", "", strings.NewReader(src), []map[string]string{{"Item": "int", "Other": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "genny:")
+		assert.NotContains(t, string(out), "interface{}")
+		assert.NotContains(t, string(out), "is what is in the set")
+		assert.Contains(t, string(out), "type (\n\tNamed string\n)")
+		assert.Contains(t, string(out), "// IntSet is a set of Ints.\ntype IntSet map[int]string")
+		assert.Contains(t, string(out), "func Hello() Named { return \"Item\" }")
+	}
+
+	names, err := Validate("generic_sets.go", strings.NewReader(src))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Item", "Other"}, names)
+
+	for bad, msg := range map[string]string{
+		"//genny:type":         "generic_bad.go:2:1: Bad directive '//genny:type': expected the names of generic types",
+		"//genny:type 1Item":   "generic_bad.go:2:1: Bad directive '//genny:type 1Item': '1Item' is not a name",
+		"//genny:type Missing": "generic_bad.go:2:1: Bad directive '//genny:type Missing': there is no declaration of type Missing",
+	} {
+		_, err := Generics("generic_bad.go", "", strings.NewReader("package bad\n"+bad+"\n"), []map[string]string{{"Item": "int"}}, "")
+		if assert.Error(t, err, bad) {
+			assert.Equal(t, msg, err.Error())
+		}
+	}
+
+}
+
+func TestTrailingComments(t *testing.T) {
+
+	src := `package values
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type // what the values are
+
+var x Item // holds the value
+
+type Box struct {
+	v Item /* the Item */ // and other Items
+	s string // a "quoted" Item
+}
+`
+
+	out, err := Generics("generic_values.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "what the values are")
+		assert.Contains(t, string(out), "\nvar x int // holds the value\n")
+		assert.Contains(t, string(out), "\tv int    /* the int */ // and other Ints\n")
+		assert.Contains(t, string(out), "\ts string // a \"quoted\" int\n")
+	}
+
+}
+
+func TestCommentRuns(t *testing.T) {
+
+	src := `package runs
+
+import "github.com/joelrahman/genny/generic"
+
+// Item is the type of the values,
+// which can be anything.
+type Item generic.Type
+
+type (
+	// Other is another type
+	// of value.
+	Other generic.Type
+)
+
+// MaxItem gets the largest of the Items.
+//
+/* It panics if there are none. */
+func MaxItem(items ...Item) Item { return items[0] }
+
+/*
+Pair is an Item with an Other.
+*/
+// It is ordered by the Item.
+type Pair struct {
+	// Value is the Item
+	// in the pair.
+	Value Item
+}
+`
+
+	out, err := Generics("generic_runs.go", "", strings.NewReader(src), []map[string]string{{"Item": "int", "Other": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "type of the values")
+		assert.NotContains(t, string(out), "can be anything")
+		assert.NotContains(t, string(out), "of value")
+		assert.Contains(t, string(out), "// MaxInt gets the largest of the Ints.\n//\n/* It panics if there are none. */\nfunc MaxInt(")
+		assert.Contains(t, string(out), "/*\nPair is an int with an string.\n*/\n// It is ordered by the int.\ntype Pair struct {")
+		assert.Contains(t, string(out), "\t// Value is the int\n\t// in the pair.\n\tValue int\n")
+	}
+
+}
+
+func TestOnlyGenericDeclarationsLeftOut(t *testing.T) {
+
+	src := `package values
+
+import "github.com/joelrahman/genny/generic"
+
+type (
+	// Item is the type of the value.
+	Item generic.Type
+	Other generic.Type
+)
+
+// ItemValue wraps an Item, which can be any generic.Type.
+type ItemValue struct{ v Item } // like generic.Type
+
+// New makes an ItemValue.
+func New(o Other) ItemValue { return ItemValue{} }
+`
+
+	out, err := Generics("generic_values.go", "", strings.NewReader(src), []map[string]string{{"Item": "int", "Other": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "type (")
+		assert.NotContains(t, string(out), "type of the value")
+		assert.Contains(t, string(out), "// IntValue wraps an int, which can be any generic.Type.\ntype IntValue struct{ v int } // like generic.Type\n")
+		assert.Contains(t, string(out), "// New makes an IntValue.\nfunc New(o string) IntValue {")
+	}
+
+}
+
+func TestKeepGenericDecls(t *testing.T) {
+
+	src := `package values
+
+import "github.com/joelrahman/genny/generic"
+
+// Item is the type of the value.
+type Item generic.Type
+
+type (
+	Other generic.Type
+	Named string
+)
+
+type ItemValue struct {
+	v Item
+	o Other
+	n Named
+}
+`
+
+	out, err := GenericsWithOptions("generic_values.go", strings.NewReader(src), []map[string]string{{"Item": "int", "Other": "string"}}, Options{KeepGenericDecls: true})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "\n// type Item generic.Type\n")
+		assert.Contains(t, string(out), "type (\n\t// Other generic.Type\n\tNamed string\n)")
+		assert.NotContains(t, string(out), "type of the value")
+		assert.Contains(t, string(out), "type IntValue struct {")
+	}
+
+}
+
+func TestUnionSpecificTypes(t *testing.T) {
+
+	src := `package process
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+func ProcessItem(v Item) Item {
+	if v == nil {
+		return Item(generic.Zero)
+	}
+	return v
+}
+`
+
+	typeSets, err := TypeSet("Item=int|string")
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := Generics("generic_process.go", "", strings.NewReader(src), typeSets, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "func ProcessIntOrString(v interface{}) interface{} {")
+		assert.Contains(t, string(out), "\t\treturn nil\n")
+	}
+
+	_, err = Generics("generic_process.go", "", strings.NewReader(strings.Replace(src, "generic.Type", "generic.Ordered", 1)), typeSets, "")
+	assert.IsType(t, &errIncompatibleSpecificType{}, err)
+
+}
+
+func TestInstantiatedSpecificTypes(t *testing.T) {
+
+	src := `package lists
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// ItemList is a list of Item.
+type ItemList struct {
+	Item
+	items []Item
+}
+
+func NewItemList(items ...Item) *ItemList {
+	return &ItemList{items: items}
+}
+
+func (l *ItemList) First() Item {
+	return l.Item
+}
+`
+
+	typeSets, err := TypeSet("Item=Option[string],Pair[string,int]")
+	if !assert.NoError(t, err) || !assert.Len(t, typeSets, 2) {
+		return
+	}
+	out, err := Generics("generic_lists.go", "", strings.NewReader(src), typeSets, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "// OptionStringList is a list of Option[string].\ntype OptionStringList struct {\n\tOption[string]\n\titems []Option[string]\n}")
+		assert.Contains(t, string(out), "func NewOptionStringList(items ...Option[string]) *OptionStringList {")
+		assert.Contains(t, string(out), "func (l *OptionStringList) First() Option[string] {\n\treturn l.Option\n}")
+		assert.Contains(t, string(out), "func NewPairStringIntList(items ...Pair[string, int]) *PairStringIntList {")
+	}
+
+}
+
+func TestLine(t *testing.T) {
+
+	for in, out := range map[string]string{
+		"":        "\n",
+		"a":       "a\n",
+		"a\n":     "a\n",
+		"a\r\n":   "a\n",
+		"a\r":     "a\n",
+		"a\n\n":   "a\n\n",
+		"a\r\r\n": "a\r\n",
+	} {
+		assert.Equal(t, out, line(in), in)
+	}
+
+}
+
+func TestCRLFSource(t *testing.T) {
+
+	src := `package values
+
+import (
+	"fmt"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+// Item is the type of the value.
+type Item generic.Type
+
+/*
+PrintItem prints an Item.
+*/
+func PrintItem(v Item) {
+	fmt.Println(v, ` + "`raw\nItem`" + `)
+}
+`
+
+	lf, err := Generics("generic_values.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}}, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	crlf, err := Generics("generic_values.go", "", strings.NewReader(strings.Replace(src, "\n", "\r\n", -1)), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(crlf), "\r")
+		assert.Equal(t, string(lf), string(crlf))
+		assert.Contains(t, string(crlf), "/*\nPrintInt prints an int.\n*/\nfunc PrintInt(v int) {")
+	}
+
+}
+
+func TestCompositeLiterals(t *testing.T) {
+
+	src := `package results
+
+import "github.com/joelrahman/genny/generic"
+
+type ResultType generic.Type
+
+type ResultTypeResult struct {
+	Value ResultType
+	Inner struct{ Values []ResultType }
+	Pairs map[string]ResultTypeResult
+}
+
+func NewResultTypeResult(x interface{}) ResultTypeResult {
+	return ResultTypeResult{Value: ResultType(x.(ResultType)), Inner: struct{ Values []ResultType }{Values: []ResultType{x.(ResultType)}}, Pairs: map[string]ResultTypeResult{"a": {Value: x.(ResultType)}}}
+}
+`
+
+	out, err := Generics("generic_results.go", "", strings.NewReader(src), []map[string]string{{"ResultType": "int"}, {"ResultType": "*Thing"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "return IntResult{Value: int(x.(int)), Inner: struct{ Values []int }{Values: []int{x.(int)}}, Pairs: map[string]IntResult{\"a\": {Value: x.(int)}}}")
+		assert.Contains(t, string(out), "return ThingResult{Value: (*Thing)(x.(*Thing)), Inner: struct{ Values []*Thing }{Values: []*Thing{x.(*Thing)}}, Pairs: map[string]ThingResult{\"a\": {Value: x.(*Thing)}}}")
+	}
+
+}
+
+func TestGenericTypesInValueSpecs(t *testing.T) {
+
+	src := `package numbers
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Number
+
+// defaultItem is the Item to start with.
+const defaultItem Item = 1
+
+var (
+	zeroItem Item
+	maxItem  = Item(100)
+)
+
+const minItem, otherItem Item = 0, 2
+
+func DefaultItem() Item { return defaultItem + zeroItem + maxItem + minItem + otherItem }
+`
+
+	out, err := Generics("generic_numbers.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "float64"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "// defaultInt is the int to start with.\nconst defaultInt int = 1\n")
+		assert.Contains(t, string(out), "var (\n\tzeroFloat64 float64\n\tmaxFloat64  = float64(100)\n)")
+		assert.Contains(t, string(out), "const minInt, otherInt int = 0, 2\n")
+		assert.Contains(t, string(out), "func DefaultFloat64() float64 {")
+	}
+
+	_, err = Validate("generic_numbers.go", strings.NewReader(src))
+	assert.NoError(t, err)
+
+	_, err = Validate("generic_numbers.go", strings.NewReader(strings.Replace(src, "const defaultItem Item = 1", "var defaultItem generic.Number = 1", 1)))
+	if assert.Error(t, err) {
+		assert.Equal(t, "generic_numbers.go:8:17: 'generic.Number' is used outside of a generic type declaration", err.Error())
+	}
+
+}
+
+func TestIotaConstGroups(t *testing.T) {
+
+	src := `package enums
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Number
+
+// The Item levels.
+const (
+	LowItem Item = iota
+
+	// MidItem is in the middle.
+	MidItem
+	HighItem // the top
+
+	_
+	MaxItem
+)
+
+type ItemFlags Item
+
+const (
+	ItemFlagA ItemFlags = 1 << iota
+	ItemFlagB
+)
+`
+
+	out, err := Generics("generic_enums.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "uint8"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), `// The uint8 levels.
+const (
+	LowUint8 uint8 = iota
+
+	// MidUint8 is in the middle.
+	MidUint8
+	HighUint8 // the top
+
+	_
+	MaxUint8
+)`)
+		assert.Contains(t, string(out), "const (\n\tIntFlagA IntFlags = 1 << iota\n\tIntFlagB\n)")
+	}
+
+}
+
+func TestSingleLetterGenericTypes(t *testing.T) {
+
+	src := `package stacks
+
+import (
+	"testing"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type T generic.Type
+
+// TStack is a stack of T values. TODO: a TTL for Ts.
+type TStack struct {
+	items []T
+}
+
+// PopT pops a T.
+func (s *TStack) PopT() (T, bool) {
+	if len(s.items) == 0 {
+		return T(generic.Zero), false
+	}
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v, true
+}
+
+func TestTStackPopT(t *testing.T) {
+	var tb testing.TB = t
+	s := &TStack{items: []T{T(generic.Zero)}}
+	if _, ok := s.PopT(); !ok {
+		tb.Fatal("nothing to pop")
+	}
+}
+`
+
+	out, err := Generics("generic_stacks_test.go", "", strings.NewReader(src), []map[string]string{{"T": "int"}, {"T": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "// IntStack is a stack of int values. TODO: a TTL for Ints.\ntype IntStack struct {")
+		assert.Contains(t, string(out), "func (s *StringStack) PopString() (string, bool) {")
+		assert.Contains(t, string(out), "func TestIntStackPopInt(t *testing.T) {\n\tvar tb testing.TB = t\n")
+		assert.NotContains(t, string(out), "testing.int")
+	}
+
+}
+
+func TestImportedIdentifiersLeftAlone(t *testing.T) {
+
+	src := `package lists
+
+import (
+	"github.com/joelrahman/genny/generic"
+	m "example.com/models"
+)
+
+type Item generic.Type
+
+type ItemList struct {
+	items []Item
+	kinds []m.ItemKind
+}
+`
+
+	out, err := Generics("generic_lists.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "\tkinds []m.ItemKind\n")
+	}
+
+}
+
+func TestGenericFieldNames(t *testing.T) {
+
+	src := `package maps
+
+import "github.com/joelrahman/genny/generic"
+
+type Key generic.Type
+
+type KeyEntry struct {
+	Key Key
+}
+
+func (e KeyEntry) Lookup() Key {
+	return e.Key
+}
+`
+
+	out, err := Generics("generic_entry.go", "", strings.NewReader(src), []map[string]string{{"Key": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "\tString string\n")
+		assert.Contains(t, string(out), "return e.String\n")
+		assert.Contains(t, string(out), "func (e StringEntry) Lookup() string {")
+	}
+
+}
+
+func TestGenerationIsDeterministic(t *testing.T) {
+
+	src := `package pairs
+
+import "github.com/joelrahman/genny/generic"
+
+type Key generic.Type
+type KeyValue generic.Type
+
+// KeyList holds a Key and a KeyValue.
+type KeyList struct {
+	key   Key
+	value KeyValue
+}
+`
+
+	typeSets := []map[string]string{{"Key": "int", "KeyValue": "string"}}
+	first, err := Generics("generic_pairs.go", "", strings.NewReader(src), typeSets, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 20; i++ {
+		out, err := Generics("generic_pairs.go", "", strings.NewReader(src), typeSets, "")
+		if assert.NoError(t, err) {
+			assert.Equal(t, string(first), string(out))
+		}
+	}
+
+}
+
+func TestOverlappingGenericTypes(t *testing.T) {
+
+	src := `package pairs
+
+import "github.com/joelrahman/genny/generic"
+
+type Key generic.Type
+type KeyValue generic.Type
+type KeyValueFunc generic.Type
+
+// KeyList holds a Key and a KeyValue.
+type KeyList struct {
+	key   Key
+	value KeyValue
+	fn    KeyValueFunc
+}
+
+func NewKeyValueList(kv KeyValue) KeyList {
+	return KeyList{value: kv}
+}
+`
+
+	out, err := Generics("generic_pairs.go", "", strings.NewReader(src), []map[string]string{{"Key": "int", "KeyValue": "string", "KeyValueFunc": "func()"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "// IntList holds a int and a string.\ntype IntList struct {\n\tkey   int\n\tvalue string\n\tfn    func()\n}")
+		assert.Contains(t, string(out), "func NewStringList(kv string) IntList {")
+	}
+
+}
+
+func TestSubstitutedLinesKeepTheirSpacing(t *testing.T) {
+
+	src, err := parseSource("generic_lists.go", strings.NewReader(`package lists
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// ItemList holds  Items
+type ItemList []Item
+var _ = ItemList{}   // an ItemList
+`), Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	spec, err := src.generate(map[string]string{"Item": "int"}, newReplacer(src, Options{}))
+	if assert.NoError(t, err) {
+		code := string(spec.code)
+		assert.Contains(t, code, "\n// IntList holds  Ints\ntype IntList []int\nvar _ = IntList{}   // an IntList\n")
+		assert.NotContains(t, code, " \n")
+	}
+
+}
+
+func TestSubstitutedLinesKeepTheirIndentation(t *testing.T) {
+
+	src, err := parseSource("generic_lists.go", strings.NewReader(`package lists
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+/*
+   Items are kept in order.
+*/
+func PrintItems(items ...Item) {
+	for _, v := range items {
+		  var item Item = v
+		_ = item
+	}
+}
+`), Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	spec, err := src.generate(map[string]string{"Item": "int"}, newReplacer(src, Options{}))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(spec.code), "/*\n   Ints are kept in order.\n*/\nfunc PrintInts(items ...int) {\n\tfor _, v := range items {\n\t\t  var item int = v\n")
+	}
+
+}
+
+// benchmarkTypeSets are 50 type sets for the multiple types template.
+var benchmarkTypeSets = Product(map[string][]string{
+	"KeyType":   {"string", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32"},
+	"ValueType": {"bool", "float32", "float64", "complex64", "complex128"},
+})
+
+func BenchmarkGenerateSequentially(b *testing.B) {
+	src := benchmarkSource(b)
+	r := newReplacer(src, Options{})
+	for n := 0; n < b.N; n++ {
+		for _, typeSet := range benchmarkTypeSets {
+			if _, err := src.generate(typeSet, r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkGenerateAll(b *testing.B) {
+	src := benchmarkSource(b)
+	for n := 0; n < b.N; n++ {
+		if _, err := generateAll(context.Background(), src, benchmarkTypeSets, Options{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerics(b *testing.B) {
+	src, err := ioutil.ReadFile("test/multipletypes/generic_simplemap.go")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for n := 0; n < b.N; n++ {
+		if _, err := Generics("generic_simplemap.go", "", bytes.NewReader(src), benchmarkTypeSets, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkSource(b *testing.B) *source {
+	f, err := os.Open("test/multipletypes/generic_simplemap.go")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	src, err := parseSource("generic_simplemap.go", f, Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return src
+}
+
+func TestImportCFollowsCgoPreamble(t *testing.T) {
+
+	src := `package cthings
+
+// #include <stdlib.h>
+import (
+	"github.com/joelrahman/genny/generic"
+	"github.com/joelrahman/genny/generic/cgeneric"
+)
+
+type Item generic.Type
+type CItem cgeneric.CType
+
+func ItemToC(v Item) CItem { return CItem(v) }
+`
+
+	out, err := Generics("generic_cthings.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "uint"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "// #include <stdlib.h>\nimport \"C\"\n")
+		assert.Equal(t, 1, strings.Count(string(out), "import \"C\""))
+		assert.Equal(t, 1, strings.Count(string(out), "#include <stdlib.h>"), string(out))
+	}
+
+}
+
+func TestImportCIsNotDuplicated(t *testing.T) {
+
+	src := `package cthings
+
+// #include <stdint.h>
+import "C"
+
+import (
+	"github.com/joelrahman/genny/generic"
+	"github.com/joelrahman/genny/generic/cgeneric"
+)
+
+type Item generic.Type
+type CItem cgeneric.CType
+
+func ItemToC(v Item) CItem { return CItem(v) }
+`
+
+	out, err := Generics("generic_cthings.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "uint"}}, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, strings.Count(string(out), "import \"C\""))
+		assert.Contains(t, string(out), "// #include <stdint.h>\nimport \"C\"\n")
+		assert.Equal(t, 1, strings.Count(string(out), "#include <stdint.h>"), string(out))
+		assert.Contains(t, string(out), "func IntToC(v int) C.int { return C.int(v) }")
+		assert.Contains(t, string(out), "func UintToC(v uint) C.uint { return C.uint(v) }")
+	}
+
+}
+
+func TestCTypesAreValidatedUpFront(t *testing.T) {
+
+	src := `package cthings
+
+import (
+	"github.com/joelrahman/genny/generic"
+	"github.com/joelrahman/genny/generic/cgeneric"
+)
+
+type Item generic.Type
+type CItem cgeneric.CNumber
+
+// ItemList is a list of Items.
+type ItemList []Item
+`
+
+	_, err := Generics("generic_cthings.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "complex128"}}, "")
+	if assert.Error(t, err) {
+		assert.Equal(t, &errUnsupportedCType{CType: "CItem", SpecificType: "complex128"}, err)
+	}
+
+	_, err = Generics("generic_cthings.go", "", strings.NewReader(src), []map[string]string{{"Item": "complex128", "CItem": "C.complexdouble"}}, "")
+	assert.NoError(t, err)
+
+}
+
+func TestReplaceEveryOccurrenceInChanAndFuncTypes(t *testing.T) {
+
+	for in, out := range map[string]string{
+		"type SomethingChan chan Something":                           "type IntChan chan int",
+		"func Recv(in <-chan Something, out chan<- Something)":        "func Recv(in <-chan int, out chan<- int)",
+		"type SomethingMapper func(Something)Something":               "type IntMapper func(int)int",
+		"func SomethingToSomething(f func(Something) Something)":      "func IntToInt(f func(int) int)",
+		"func AppendSomethings(items ...Something) []Something":       "func AppendInts(items ...int) []int",
+		"type SomethingReducer func(...Something) (Something, error)": "type IntReducer func(...int) (int, error)",
+	} {
+		actual, _, err := (&replacer{}).identifiers(in, "Something", "int")
+		if assert.NoError(t, err) {
+			assert.Equal(t, out, actual)
+		}
+	}
+
+}
+
+func TestReplaceCapitalizesGenericTypeWithinIdentifiers(t *testing.T) {
+
+	for in, out := range map[string]string{
+		"func newItemQueue() *ItemQueue":           "func newTimeDurationQueue() *TimeDurationQueue",
+		"func (q *ItemQueue) appendItems(v *Item)": "func (q *TimeDurationQueue) appendTimeDurations(v *time.Duration)",
+		"return &itemBox{}, (*ItemBox)(nil)":       "return &timeDurationBox{}, (*TimeDurationBox)(nil)",
+	} {
+		actual := in
+		for _, generic := range []string{"Item", "item"} {
+			var err error
+			actual, _, err = (&replacer{}).identifiers(actual, generic, "time.Duration")
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, out, actual)
+	}
+
+}
+
+func TestGenericSizeConstants(t *testing.T) {
+
+	src := `package buffers
+
+import "github.com/joelrahman/genny/generic"
+
+const Length = generic.Size
+
+// BufferLength is a buffer of Length bytes.
+type BufferLength [Length]byte
+`
+
+	out, err := Generics("generic_buffers.go", "", strings.NewReader(src), []map[string]string{{"Length": "16"}, {"Length": "0x20"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "generic.Size")
+		assert.Contains(t, string(out), "// Buffer16 is a buffer of 16 bytes.\ntype Buffer16 [16]byte")
+		assert.Contains(t, string(out), "type Buffer0x20 [0x20]byte")
+	}
+
+	for _, specific := range []string{"int", "-1", "1.5"} {
+		_, err := Generics("generic_buffers.go", "", strings.NewReader(src), []map[string]string{{"Length": specific}}, "")
+		if assert.IsType(t, &errIncompatibleSpecificType{}, err, specific) {
+			assert.Equal(t, "generic.Size", err.(*errIncompatibleSpecificType).Kind)
+		}
+	}
+
+	names, err := Validate("generic_buffers.go", strings.NewReader(src))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Length"}, names)
+
+	_, err = GenericsGeneric("generic_buffers.go", "", strings.NewReader(src))
+	assert.IsType(t, &errGenericsUnsupported{}, err)
+
+}
+
+func TestZeroValue(t *testing.T) {
+
+	for specific, zero := range map[string]string{
+		"int":             "0",
+		"float64":         "0",
+		"complex128":      "0",
+		"string":          `""`,
+		"bool":            "false",
+		"error":           "nil",
+		"*Thing":          "nil",
+		"[]byte":          "nil",
+		"map[string]int":  "nil",
+		"chan int":        "nil",
+		"func() error":    "nil",
+		"interface{}":     "nil",
+		"[4]int":          "[4]int{}",
+		"struct{ X int }": "struct{ X int }{}",
+		"time.Duration":   "*new(time.Duration)",
+		"Thing":           "*new(Thing)",
+		"uuid.UUID":       "*new(uuid.UUID)",
+	} {
+		assert.Equal(t, zero, zeroValue(specific), specific)
+	}
+
+}
+
+func TestGenericZero(t *testing.T) {
+
+	src := `package finds
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// FindItem gets the first Item ok is true for.
+func FindItem(items []Item, ok func(Item) bool) Item {
+	for _, v := range items {
+		if ok(v) {
+			return v
+		}
+	}
+	return Item(generic.Zero)
+}
+`
+
+	out, err := Generics("generic_finds.go", "", strings.NewReader(src), []map[string]string{{"Item": "int"}, {"Item": "string"}, {"Item": "*bool"}}, "")
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "generic")
+		assert.Contains(t, string(out), "\treturn 0\n")
+		assert.Contains(t, string(out), "\treturn \"\"\n")
+		assert.Contains(t, string(out), "\treturn nil\n")
+	}
+
+	_, err = Validate("generic_finds.go", strings.NewReader(src))
+	assert.NoError(t, err)
+
+	_, err = Validate("generic_finds.go", strings.NewReader(strings.Replace(src, "Item(generic.Zero)", "generic.Zero", 1)))
+	if assert.Error(t, err) {
+		assert.Equal(t, "generic_finds.go:14:9: 'generic.Zero' is only the zero value of a generic type, like Item(generic.Zero)", err.Error())
+	}
+
+}
+
+func TestChangePackage(t *testing.T) {
+
+	for in, out := range map[string]string{
+		"package foo\n":                "package bar\n",
+		"package foo // doc\n":         "package bar // doc\n",
+		"package  foo\n":               "package  bar\n",
+		"package\tfoo\t// doc\n":       "package\tbar\t// doc\n",
+		"package foo_1\nvar x = 1\n":   "package bar\nvar x = 1\n",
+		"// packages\npackage foo\n":   "// packages\npackage bar\n",
+		"package foo\n\npackage baz\n": "package bar\n\npackage baz\n",
+		"package foo_test\n":           "package bar_test\n",
+	} {
+		assert.Equal(t, out, string(changePackage(strings.NewReader(in), "bar")), in)
+	}
+
+}
+
+func TestUnknownGenericType(t *testing.T) {
+
+	src := `package pairs
+
+import "github.com/joelrahman/genny/generic"
+
+type Key generic.Type
+type Value generic.Type
+
+type KeyValuePair struct {
+	Key   Key
+	Value Value
+}
+`
+
+	_, err := Generics("generic_pairs.go", "", strings.NewReader(src), []map[string]string{{"Key": "string", "Value": "int", "Valeu": "int"}}, "")
+	if assert.IsType(t, &errUnknownGenericType{}, err) {
+		assert.Equal(t, "Type set has a specific type for 'Valeu' which isn't a generic type in the source (they are Key, Value)", err.Error())
+	}
+
+	// type sets shared with other templates can have other generic types
+	out, err := GenericsWithOptions("generic_pairs.go", strings.NewReader(src), []map[string]string{
+		{"Key": "string", "Value": "int", "Item": "Value"},
+		{"Key": "string", "Value": "int", "Item": "bool"},
+	}, Options{IgnoreUnknownGenericTypes: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, strings.Count(string(out), "type StringIntPair struct {"))
+	}
+
+	// C types can take their specific type from the Go type
+	csrc := `package ctypes
+
+import "github.com/joelrahman/genny/generic/cgeneric"
+
+type CItem cgeneric.CType
+
+func ZeroC() (v CItem) { return }
+`
+	out, err = Generics("generic_ctypes.go", "", strings.NewReader(csrc), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "func ZeroC() (v C.int) { return }")
+	}
+
+}
+
+func TestSelfReferentialTypeSets(t *testing.T) {
+
+	src := `package pairs
+
+import "github.com/joelrahman/genny/generic"
+
+type Key generic.Type
+type Value generic.Type
+
+type KeyValuePair struct {
+	K Key
+	V Value
+}
+`
+
+	for _, test := range []struct {
+		typeSet map[string]string
+		err     string
+	}{
+		{map[string]string{"Key": "Key", "Value": "int"}, "Type set replaces generic type 'Key' with itself"},
+		{map[string]string{"Key": "Value", "Value": "int"}, "Specific type 'Value' for generic type 'Key' has generic type 'Value' in it, which would be replaced too"},
+		{map[string]string{"Key": "string", "Value": "[]models.Keys"}, "Specific type '[]models.Keys' for generic type 'Value' has generic type 'Key' in it, which would be replaced too"},
+	} {
+		_, err := Generics("generic_pairs.go", "", strings.NewReader(src), []map[string]string{test.typeSet}, "")
+		if assert.IsType(t, &errSelfReferentialType{}, err, test.err) {
+			assert.Equal(t, test.err, err.Error())
+		}
+	}
+
+	// a generic type can be replaced with a type of the same name from
+	// another package, and with types that only look a bit like another
+	_, err := Generics("generic_pairs.go", "", strings.NewReader(src), []map[string]string{{"Key": "models.Key", "Value": "Keyboard"}}, "")
+	assert.NoError(t, err)
+
+}
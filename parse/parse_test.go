@@ -1,9 +1,14 @@
 package parse_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"go/scanner"
 	"io/ioutil"
 	"log"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/joelrahman/genny/parse"
@@ -64,6 +69,12 @@ var tests = []struct {
 		types:       []map[string]string{{"secret": "*myType"}},
 		expectedOut: `test/unexported/mytype_internal.go`,
 	},
+	{
+		filename:    "generic_box.go",
+		in:          `test/unexportedmethods/generic_box.go`,
+		types:       []map[string]string{{"secret": "*myType"}},
+		expectedOut: `test/unexportedmethods/mytype_box.go`,
+	},
 	{
 		filename: "generic_simplemap.go",
 		in:       `test/multipletypesets/generic_simplemap.go`,
@@ -85,6 +96,69 @@ var tests = []struct {
 		types:       []map[string]string{{"Node": "int"}},
 		expectedOut: `test/bugreports/int_digraph.go`,
 	},
+	{
+		filename:    "generic_string.go",
+		in:          `test/strings/generic_string.go`,
+		types:       []map[string]string{{"Text": "Name"}},
+		expectedOut: `test/strings/name_string.go`,
+	},
+	{
+		filename:    "generic_queue.go",
+		in:          `test/alias/generic_queue.go`,
+		types:       []map[string]string{{"Something": "int"}},
+		expectedOut: `test/alias/int_queue.go`,
+	},
+	{
+		filename:    "generic_comments.go",
+		in:          `test/comments/generic_comments.go`,
+		types:       []map[string]string{{"Something": "int"}},
+		expectedOut: `test/comments/int_comments.go`,
+	},
+	{
+		filename:    "generic_literals.go",
+		in:          `test/literals/generic_literals.go`,
+		types:       []map[string]string{{"ValueType": "int"}},
+		expectedOut: `test/literals/out/int_literals.go`,
+	},
+	{
+		filename:    "generic_dedupe.go",
+		in:          `test/dedupe/generic_dedupe.go`,
+		types:       []map[string]string{{"Item": "int"}, {"Item": "string"}},
+		expectedOut: `test/dedupe/out/int_string_dedupe.go`,
+	},
+	{
+		filename:    "generic_ordered.go",
+		in:          `test/ordered/generic_ordered.go`,
+		types:       []map[string]string{{"Key": "string"}},
+		expectedOut: `test/ordered/string_ordered.go`,
+	},
+	{
+		filename:    "generic_tagged.go",
+		in:          `test/buildtags/generic_tagged.go`,
+		types:       []map[string]string{{"Item": "int"}, {"Item": "string"}},
+		expectedOut: `test/buildtags/int_string_tagged.go`,
+	},
+	{
+		filename:    "generic_license.go",
+		in:          `test/license/generic_license.go`,
+		types:       []map[string]string{{"Item": "int"}, {"Item": "string"}},
+		expectedOut: `test/license/int_string_license.go`,
+	},
+	{
+		filename: "generic_ctypes.go",
+		in:       `test/ctypes/generic_ctypes.go`,
+		types: []map[string]string{
+			{"Item": "bool"}, {"Item": "byte"}, {"Item": "uint8"}, {"Item": "int8"},
+			{"Item": "int16"}, {"Item": "uint16"}, {"Item": "uintptr"},
+		},
+		expectedOut: `test/ctypes/many_ctypes.go`,
+	},
+	{
+		filename:    "generic_conditional.go",
+		in:          `test/conditional/generic_conditional.go`,
+		types:       []map[string]string{{"Item": "int"}, {"Item": "string"}},
+		expectedOut: `test/conditional/int_string_conditional.go`,
+	},
 }
 
 func TestParse(t *testing.T) {
@@ -94,7 +168,7 @@ func TestParse(t *testing.T) {
 		test.in = contents(test.in)
 		test.expectedOut = contents(test.expectedOut)
 
-		bytes, err := parse.Generics(test.filename, test.pkgName, strings.NewReader(test.in), test.types)
+		bytes, err := parse.Generics(test.filename, test.pkgName, strings.NewReader(test.in), test.types, "")
 
 		// check the error
 		if test.expectedErr == nil {
@@ -114,6 +188,517 @@ func TestParse(t *testing.T) {
 
 }
 
+func TestGenericsTo(t *testing.T) {
+
+	for _, test := range tests {
+
+		in := contents(test.in)
+		expected, expectedErr := parse.Generics(test.filename, test.pkgName, strings.NewReader(in), test.types, "")
+
+		var buf bytes.Buffer
+		err := parse.GenericsTo(&buf, test.filename, test.pkgName, strings.NewReader(in), test.types, "")
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, string(expected), buf.String(), "(%s) GenericsTo should write the same output as Generics", test.filename)
+
+	}
+
+}
+
+func TestGenericsBytes(t *testing.T) {
+
+	for _, test := range tests {
+
+		in := contents(test.in)
+		expected, expectedErr := parse.Generics(test.filename, test.pkgName, strings.NewReader(in), test.types, "")
+		out, err := parse.GenericsBytes([]byte(in), test.filename, test.pkgName, test.types)
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, string(expected), string(out), "(%s) GenericsBytes should give the same output as Generics", test.filename)
+
+	}
+
+}
+
+func TestGenericsProductNamesAreUnique(t *testing.T) {
+
+	typeSets := parse.Product(map[string][]string{
+		"KeyType":   {"string", "int"},
+		"ValueType": {"int", "bool"},
+	})
+	in := contents(`test/multipletypes/generic_simplemap.go`)
+	out, err := parse.Generics("generic_simplemap.go", "", strings.NewReader(in), typeSets, "")
+	if assert.NoError(t, err) {
+		for _, name := range []string{"StringIntMap", "StringBoolMap", "IntIntMap", "IntBoolMap"} {
+			assert.Equal(t, 1, strings.Count(string(out), "type "+name+" "), name)
+		}
+	}
+
+}
+
+func TestGenericsAddsImportsForQualifiedTypes(t *testing.T) {
+
+	in := contents(`test/alias/generic_queue.go`)
+	out, err := parse.Generics("generic_queue.go", "", strings.NewReader(in), []map[string]string{
+		{"Something": "github.com/google/uuid.UUID"},
+		{"Something": "gopkg.in/yaml.v2.Node"},
+	}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), `import (
+	"github.com/google/uuid"
+	yaml "gopkg.in/yaml.v2"
+)`)
+		assert.Contains(t, string(out), "items []uuid.UUID")
+		assert.Contains(t, string(out), "items []yaml.Node")
+	}
+
+}
+
+func TestGenericsSlicesOfQualifiedTypes(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	out, err := parse.Generics("generic_queue.go", "", strings.NewReader(in), []map[string]string{
+		{"Something": "[]github.com/google/uuid.UUID"},
+		{"Something": "[]*os.File"},
+	}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), `import (
+	"os"
+
+	"github.com/google/uuid"
+)`)
+		assert.Contains(t, string(out), "type UuidUUIDSliceQueue struct {\n\titems [][]uuid.UUID\n}")
+		assert.Contains(t, string(out), "func (q *UuidUUIDSliceQueue) Push(item []uuid.UUID) {")
+		assert.Contains(t, string(out), "type OsFileSliceQueue struct {\n\titems [][]*os.File\n}")
+	}
+
+}
+
+func TestGenericsWithOptionsCRLF(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	typeSets := []map[string]string{{"Something": "int"}}
+	lf, err := parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotContains(t, string(lf), "\r")
+
+	crlf, err := parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{CRLF: true, Hash: true})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(crlf), "package queue\r\n")
+		assert.NotContains(t, strings.Replace(string(crlf), "\r\n", "", -1), "\n")
+		assert.Equal(t, parse.InputHashWithOptions([]byte(in), typeSets, parse.Options{CRLF: true}), parse.ReadHash(crlf))
+	}
+
+	assert.Equal(t, "a\r\nb\r\n", string(parse.CRLF([]byte("a\r\nb\n"))))
+
+}
+
+func TestGenericsWithOptionsLog(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	typeSets := []map[string]string{{"Something": "int"}, {"Something": "string"}}
+	var log bytes.Buffer
+	_, err := parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{Log: &log})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `generic_queue.go:6:6: generic type Something (generic.Type)
+generic_queue.go: generating Something=int
+generic_queue.go: generating Something=string
+`, log.String())
+	}
+
+	log.Reset()
+	_, err = parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{Log: &log, LogReplacements: true})
+	if assert.NoError(t, err) {
+		assert.Contains(t, log.String(), "generic_queue.go: generating Something=string\n")
+		assert.Contains(t, log.String(), `generic_queue.go:9: "type SomethingQueue struct {" becomes "type StringQueue struct {"`+"\n")
+		assert.Equal(t, 2*8+3, strings.Count(log.String(), "\n"))
+	}
+
+}
+
+func TestGenericsWithOptionsPackageDoc(t *testing.T) {
+
+	in := `// Package lists has lists of anything.
+package lists
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+type ItemList []Item
+`
+
+	typeSets := []map[string]string{{"Item": "int"}, {"Item": "string"}}
+	out, err := parse.GenericsWithOptions("generic_lists.go", strings.NewReader(in), typeSets, parse.Options{
+		PackageDoc: "Package lists has lists of ints and strings.\n\nIt is generated.\n",
+	})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "see https://github.com/joelrahman/genny\n\n// Package lists has lists of ints and strings.\n//\n// It is generated.\npackage lists\n")
+		assert.Equal(t, 1, strings.Count(string(out), "// Package lists"))
+	}
+
+	in = strings.TrimPrefix(in, "// Package lists has lists of anything.\n")
+	out, err = parse.GenericsWithOptions("generic_lists.go", strings.NewReader(in), typeSets, parse.Options{
+		PackageDoc: "// Package lists has lists of ints and strings.",
+	})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "see https://github.com/joelrahman/genny\n\n// Package lists has lists of ints and strings.\npackage lists\n")
+	}
+
+}
+
+func TestGenericsWithOptionsHeader(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	typeSets := []map[string]string{{"Something": "int"}}
+
+	out, err := parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{
+		Header: "// Copyright 2019 The Authors.\n// Generated by genny.\n",
+	})
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(string(out), "// Copyright 2019 The Authors.\n// Generated by genny.\n\npackage queue"), string(out))
+		assert.NotContains(t, string(out), "Any changes will be lost")
+	}
+
+	out, err = parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{Editable: true})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "automatically generated by genny")
+		assert.NotContains(t, string(out), "Any changes will be lost")
+	}
+
+	expected, err := parse.Generics("generic_queue.go", "", strings.NewReader(in), typeSets, "")
+	if assert.NoError(t, err) {
+		out, err = parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{})
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(out))
+	}
+
+}
+
+func TestGenericsWithResult(t *testing.T) {
+
+	in := contents(`test/dedupe/generic_dedupe.go`)
+	res, err := parse.GenericsWithResult("generic_dedupe.go", strings.NewReader(in), []map[string]string{{"Item": "int"}, {"Item": "string"}}, parse.Options{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, contents(`test/dedupe/out/int_string_dedupe.go`), string(res.Code))
+		assert.Equal(t, []string{"Item"}, res.Generics)
+		assert.False(t, res.NeedC)
+		assert.Equal(t, "dedupe", res.Package)
+		assert.Equal(t, 6, res.Decls)
+		assert.Equal(t, []string{"defaultCapacity", "IntList", "NewIntList", "capacity", "StringList", "NewStringList"}, res.Names)
+		assert.Equal(t, []string{"defaultCapacity", "capacity"}, res.Duplicates)
+	}
+
+	in = contents(`test/multipletypes/generic_simplemap.go`)
+	res, err = parse.GenericsWithResult("generic_simplemap.go", strings.NewReader(in), []map[string]string{{"KeyType": "string", "ValueType": "int"}}, parse.Options{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"KeyType", "ValueType"}, res.Generics)
+		assert.Equal(t, []string{"StringIntMap", "StringIntMap.Has", "StringIntMap.Get", "StringIntMap.Set"}, res.Names)
+	}
+
+	in = `package lists
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+// PrintItem prints the Item.
+func PrintItem(v Item) {
+	fmt.Println(v)
+}
+`
+	res, err = parse.GenericsWithResult("lists.go", strings.NewReader(in), []map[string]string{{"Item": "github.com/google/uuid.UUID"}}, parse.Options{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"fmt", "github.com/google/uuid"}, res.Imports)
+		assert.Equal(t, []string{"github.com/google/uuid"}, res.AddedImports)
+		assert.Equal(t, []string{"sort"}, res.RemovedImports)
+		assert.Equal(t, [][]string{nil}, res.Unused)
+	}
+
+	in = strings.Replace(in, "type Item generic.Type", "type Item generic.Type\ntype Other generic.Type", 1)
+	res, err = parse.GenericsWithResult("lists.go", strings.NewReader(in), []map[string]string{{"Item": "int", "Other": "string"}, {"Item": "bool", "Other": "bool"}}, parse.Options{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, [][]string{{"Other"}, {"Other"}}, res.Unused)
+	}
+
+}
+
+func TestValidate(t *testing.T) {
+
+	for _, test := range tests {
+		_, err := parse.Validate(test.filename, strings.NewReader(contents(test.in)))
+		assert.NoError(t, err, test.in)
+	}
+
+	names, err := parse.Validate("generic_simplemap.go", strings.NewReader(contents(`test/multipletypes/generic_simplemap.go`)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"KeyType", "ValueType"}, names)
+
+	names, err = parse.Validate("generic_stray.go", strings.NewReader(`package stray
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+type Other generic.Typo
+
+var Default generic.Number
+`))
+	assert.Equal(t, []string{"Item", "Other"}, names)
+	if assert.Error(t, err) {
+		assert.Equal(t, "generic_stray.go:6:12: 'generic.Typo' is not a generic type\ngeneric_stray.go:8:13: 'generic.Number' is used outside of a generic type declaration", err.Error())
+	}
+
+}
+
+func TestGenericTypes(t *testing.T) {
+
+	params, err := parse.GenericTypes("generic_types.go", strings.NewReader(`package types
+
+import (
+	"github.com/joelrahman/genny/generic"
+	"github.com/joelrahman/genny/generic/cgeneric"
+)
+
+type (
+	Key   generic.Type
+	Count generic.Number
+)
+
+type CValue cgeneric.CType
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []parse.GenericParam{
+			{Name: "Key", Kind: "Type"},
+			{Name: "Count", Kind: "Number"},
+			{Name: "CValue", Kind: "CType"},
+		}, params)
+	}
+
+	_, err = parse.GenericTypes("broken.go", strings.NewReader("package"))
+	assert.Error(t, err)
+
+}
+
+func TestGenericsContext(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	typeSets := []map[string]string{{"Something": "int"}}
+
+	out, err := parse.GenericsContext(context.Background(), "generic_queue.go", strings.NewReader(in), typeSets, parse.Options{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, contents(`test/queue/int_queue.go`), string(out))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = parse.GenericsContext(ctx, "generic_queue.go", strings.NewReader(in), typeSets, parse.Options{})
+	assert.Equal(t, context.Canceled, err)
+
+}
+
+func TestGenericsGoGenerateLines(t *testing.T) {
+
+	in := `package colors
+
+//go:generate genny -in=$GOFILE -out=gen-$GOFILE gen "Item=int"
+//go:generate stringer -type=Color
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+type Color int
+
+type ItemBox struct {
+	Value Item
+	Color Color
+}
+`
+	typeSets := []map[string]string{{"Item": "int"}}
+	genny := "//go:generate genny -in=$GOFILE"
+	stringer := "//go:generate stringer -type=Color"
+
+	out, err := parse.GenericsWithOptions("generic_colors.go", strings.NewReader(in), typeSets, parse.Options{})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), genny)
+		assert.Contains(t, string(out), stringer)
+	}
+
+	out, err = parse.GenericsWithOptions("generic_colors.go", strings.NewReader(in), typeSets, parse.Options{KeepGoGenerate: true})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), genny)
+		assert.Contains(t, string(out), stringer)
+	}
+
+	out, err = parse.GenericsWithOptions("generic_colors.go", strings.NewReader(in), typeSets, parse.Options{StripGoGenerate: "stringer"})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), genny)
+		assert.NotContains(t, string(out), stringer)
+	}
+
+	// go generate only runs each of them once
+	out, err = parse.GenericsWithOptions("generic_colors.go", strings.NewReader(in), []map[string]string{{"Item": "int"}, {"Item": "string"}}, parse.Options{KeepGoGenerate: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, strings.Count(string(out), stringer), string(out))
+		assert.Contains(t, string(out), "type StringBox struct")
+	}
+
+}
+
+func TestGenericsStripPrefixes(t *testing.T) {
+
+	in := `package boxes
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+//genny:template-only
+// ItemBox holds an Item.
+type ItemBox struct {
+	Value Item
+}
+`
+
+	out, err := parse.GenericsWithOptions("generic_boxes.go", strings.NewReader(in), []map[string]string{{"Item": "int"}}, parse.Options{
+		StripPrefixes: []string{"//genny:template-only"},
+	})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), "//genny:template-only")
+		assert.Contains(t, string(out), "// IntBox holds an int.\ntype IntBox struct")
+	}
+
+}
+
+func TestGenericsWithOwnGenericPackage(t *testing.T) {
+
+	in := `package boxes
+
+import (
+	"ourco/internal/generic"
+	placeholders "ourco/internal/genny-types"
+)
+
+type Item generic.Type
+type Other placeholders.Type
+
+type ItemBox struct {
+	Value Item
+}
+
+type OtherBox struct {
+	Value Other
+}
+`
+
+	out, err := parse.GenericsWithOptions("generic_boxes.go", strings.NewReader(in), []map[string]string{{"Item": "int"}}, parse.Options{
+		GenericImportPath: "ourco/internal/generic",
+	})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "type IntBox struct {\n\tValue int\n}")
+		assert.NotContains(t, string(out), "ourco/internal/generic")
+	}
+
+	out, err = parse.GenericsWithOptions("generic_boxes.go", strings.NewReader(in), []map[string]string{{"Other": "int"}}, parse.Options{
+		GenericImportPath:  "ourco/internal/genny-types",
+		GenericPackageName: "gennytypes",
+	})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "type IntBox struct {\n\tValue int\n}")
+		assert.NotContains(t, string(out), "ourco/internal/genny-types")
+	}
+
+}
+
+func TestGenericsStripsGenericImports(t *testing.T) {
+
+	in := `package lists
+
+import (
+	"fmt"
+
+	_ "github.com/joelrahman/genny/generic"
+	g "github.com/joelrahman/genny/generic"
+)
+
+type Item g.Type
+
+func PrintItem(i Item) {
+	fmt.Println(i)
+}
+`
+
+	out, err := parse.Generics("generic_lists.go", "", strings.NewReader(in), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "func PrintInt(i int) {")
+		assert.NotContains(t, string(out), "genny/generic")
+	}
+
+	// genny's own package goes too when the template uses another one
+	in = `package lists
+
+import (
+	"fmt"
+
+	_ "github.com/joelrahman/genny/generic"
+	"ourco/internal/generic"
+)
+
+type Item generic.Type
+
+func PrintItem(i Item) {
+	fmt.Println(i)
+}
+`
+
+	out, err = parse.GenericsWithOptions("generic_lists.go", strings.NewReader(in), []map[string]string{{"Item": "int"}}, parse.Options{
+		GenericImportPath: "ourco/internal/generic",
+	})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "func PrintInt(i int) {")
+		assert.NotContains(t, string(out), "genny/generic")
+		assert.NotContains(t, string(out), "ourco/internal/generic")
+	}
+
+}
+
+func TestGenericsKeepsBlankAndDotImports(t *testing.T) {
+
+	in := `package stores
+
+import (
+	"database/sql"
+
+	. "math"
+
+	_ "github.com/lib/pq"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+type ItemStore struct {
+	db *sql.DB
+}
+`
+
+	typeSets := []map[string]string{{"Item": "int"}, {"Item": "string"}}
+	for _, opts := range []parse.Options{{}, {FormatOnly: true}} {
+		out, err := parse.GenericsWithOptions("generic_stores.go", strings.NewReader(in), typeSets, opts)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 1, strings.Count(string(out), `_ "github.com/lib/pq"`))
+			assert.Equal(t, 1, strings.Count(string(out), `. "math"`))
+		}
+	}
+
+}
+
 func contents(s string) string {
 	if strings.HasSuffix(s, "go") {
 		file, err := ioutil.ReadFile(s)
@@ -124,3 +709,387 @@ func contents(s string) string {
 	}
 	return s
 }
+
+func TestGenericsMergesImportBlocks(t *testing.T) {
+
+	in := `package lists
+
+import "fmt"
+
+import (
+	"strings"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+// ItemString gets the Item as an upper case string.
+func ItemString(v Item) string {
+	return strings.ToUpper(fmt.Sprint(v))
+}
+`
+	out, err := parse.Generics("lists.go", "", strings.NewReader(in), []map[string]string{
+		{"Item": "int"},
+		{"Item": "time.Duration"},
+	}, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, strings.Count(string(out), "import"))
+		assert.Contains(t, string(out), `import (
+	"fmt"
+	"strings"
+	"time"
+)`)
+	}
+
+}
+
+func TestGenericsImportsAfterPackageComment(t *testing.T) {
+
+	in := `// Package lists has lists.
+package lists // import "example.com/lists"
+
+import (
+	"fmt"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+func PrintItem(v Item) {
+	fmt.Println(v)
+}
+`
+	out, err := parse.Generics("lists.go", "", strings.NewReader(in), []map[string]string{{"Item": "int"}, {"Item": "string"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "// Package lists has lists.\npackage lists // import \"example.com/lists\"\n\nimport (\n\t\"fmt\"\n)\n")
+	}
+
+}
+
+func TestGenericsFormatOnly(t *testing.T) {
+
+	in := `package lists
+
+import (
+	"sort"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+// ItemList is a list of Items.
+type ItemList []Item
+`
+	out, err := parse.GenericsWithOptions("lists.go", strings.NewReader(in), []map[string]string{{"Item": "int"}}, parse.Options{})
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(out), `"sort"`)
+	}
+
+	out, err = parse.GenericsWithOptions("lists.go", strings.NewReader(in), []map[string]string{{"Item": "int"}}, parse.Options{FormatOnly: true})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), `import (
+	"sort"
+)`)
+		assert.NotContains(t, string(out), "genny/generic")
+		assert.Contains(t, string(out), "type IntList []int")
+	}
+
+}
+
+func TestGenericsLocalPrefix(t *testing.T) {
+
+	in := `package lists
+
+import (
+	"fmt"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+// PrintItem prints the Item.
+func PrintItem(v Item) {
+	fmt.Println(v)
+}
+`
+	out, err := parse.GenericsWithOptions("lists.go", strings.NewReader(in), []map[string]string{
+		{"Item": "github.com/google/uuid.UUID"},
+		{"Item": "example.com/ourco/money.Amount"},
+	}, parse.Options{LocalPrefix: "example.com/ourco"})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), `import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"example.com/ourco/money"
+)`)
+	}
+
+	// calls at the same time don't see each other's prefix
+	typeSets := []map[string]string{{"Item": "github.com/google/uuid.UUID"}, {"Item": "example.com/ourco/money.Amount"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		opts := parse.Options{}
+		if i%2 == 0 {
+			opts.LocalPrefix = "example.com/ourco"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := parse.GenericsWithOptions("lists.go", strings.NewReader(in), typeSets, opts)
+			if assert.NoError(t, err) {
+				assert.Equal(t, opts.LocalPrefix != "", strings.Contains(string(out), "\"github.com/google/uuid\"\n\n\t\"example.com/ourco/money\""))
+			}
+		}()
+	}
+	wg.Wait()
+
+}
+
+func TestGenericsPostProcess(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	typeSets := []map[string]string{{"Something": "int"}}
+	out, err := parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{
+		PostProcess: func(code []byte) ([]byte, error) {
+			return append([]byte("//nolint\n"), code...), nil
+		},
+	})
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(string(out), "//nolint\n"))
+		assert.Contains(t, string(out), "type IntQueue struct")
+	}
+
+	failed := errors.New("post processing failed")
+	_, err = parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{
+		PostProcess: func([]byte) ([]byte, error) { return nil, failed },
+	})
+	assert.Equal(t, failed, err)
+
+}
+
+func TestGenericsMapTypes(t *testing.T) {
+
+	in := `package maps
+
+import "github.com/joelrahman/genny/generic"
+
+type KeyType generic.Type
+type ValueType generic.Type
+
+// KeyTypeValueTypeMap maps KeyTypes to ValueTypes.
+type KeyTypeValueTypeMap map[KeyType]ValueType
+
+// NewKeyTypeValueTypeMap makes a KeyTypeValueTypeMap.
+func NewKeyTypeValueTypeMap() map[KeyType]ValueType {
+	return make(map[KeyType]ValueType)
+}
+
+// Index maps each ValueType to the KeyTypes it is stored under.
+func (m KeyTypeValueTypeMap) Index() map[ValueType][]KeyType {
+	index := make(map[ValueType][]KeyType)
+	for k, v := range m {
+		index[v] = append(index[v], k)
+	}
+	return index
+}
+`
+	out, err := parse.Generics("maps.go", "", strings.NewReader(in), []map[string]string{{"KeyType": "string", "ValueType": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "type StringIntMap map[string]int")
+		assert.Contains(t, string(out), "func NewStringIntMap() map[string]int {\n\treturn make(map[string]int)\n}")
+		assert.Contains(t, string(out), "func (m StringIntMap) Index() map[int][]string {\n\tindex := make(map[int][]string)")
+	}
+
+}
+
+func TestGenericsVariadicParameters(t *testing.T) {
+
+	in := `package lists
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// AppendItem adds the Items to the list.
+func AppendItem(list []Item, items ...Item) []Item {
+	return append(list, items...)
+}
+
+// AppendItemPointers adds pointers to the Items to the list.
+func AppendItemPointers(list []*Item, items ...*Item) []*Item {
+	return append(list, items...)
+}
+`
+	out, err := parse.Generics("lists.go", "", strings.NewReader(in), []map[string]string{{"Item": "int"}, {"Item": "time.Duration"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "func AppendInt(list []int, items ...int) []int {\n\treturn append(list, items...)\n}")
+		assert.Contains(t, string(out), "func AppendIntPointers(list []*int, items ...*int) []*int {")
+		assert.Contains(t, string(out), "func AppendTimeDuration(list []time.Duration, items ...time.Duration) []time.Duration {")
+		assert.Contains(t, string(out), "func AppendTimeDurationPointers(list []*time.Duration, items ...*time.Duration) []*time.Duration {")
+	}
+
+}
+
+func TestGenericsEmbeddedGenericTypes(t *testing.T) {
+
+	in := `package wrap
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// ItemWrapper wraps an Item.
+type ItemWrapper struct {
+	Item
+	count int
+}
+
+// NewItemWrapper wraps the Item.
+func NewItemWrapper(v Item) *ItemWrapper {
+	return &ItemWrapper{Item: v, count: 1}
+}
+
+// Wrapped gets the wrapped Item.
+func (w *ItemWrapper) Wrapped() *Item {
+	return &w.Item
+}
+`
+	out, err := parse.Generics("wrap.go", "", strings.NewReader(in), []map[string]string{{"Item": "bytes.Buffer"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "type BytesBufferWrapper struct {\n\tbytes.Buffer\n\tcount int\n}")
+		assert.Contains(t, string(out), "return &w.Buffer")
+		assert.Contains(t, string(out), "return &BytesBufferWrapper{Buffer: v, count: 1}")
+	}
+
+	// a type of the same package keeps its name
+	out, err = parse.Generics("wrap.go", "", strings.NewReader(in), []map[string]string{{"Item": "Option"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "type OptionWrapper struct {\n\tOption\n\tcount int\n}")
+		assert.Contains(t, string(out), "return &OptionWrapper{Option: v, count: 1}")
+	}
+
+}
+
+func TestGenericsHash(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	typeSets := []map[string]string{{"Something": "int"}}
+	out, err := parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{Hash: true})
+	if assert.NoError(t, err) {
+		hash := parse.InputHashWithOptions([]byte(in), typeSets, parse.Options{Hash: true})
+		assert.Contains(t, string(out), "// see https://github.com/joelrahman/genny\n// genny-hash: "+hash+"\n\npackage queue\n")
+		assert.Equal(t, hash, parse.ReadHash(out))
+	}
+
+	assert.Equal(t, parse.InputHash([]byte(in), typeSets), parse.InputHash([]byte(in), []map[string]string{{"Something": "int"}}))
+	assert.NotEqual(t, parse.InputHash([]byte(in), typeSets), parse.InputHash([]byte(in), []map[string]string{{"Something": "string"}}))
+	assert.NotEqual(t, parse.InputHash([]byte(in), typeSets), parse.InputHash([]byte(in+"\n"), typeSets))
+	assert.Equal(t, "", parse.ReadHash([]byte(contents(`test/queue/int_queue.go`))))
+
+	// only the options change
+	hash := parse.InputHash([]byte(in), typeSets)
+	assert.Equal(t, hash, parse.InputHashWithOptions([]byte(in), typeSets, parse.Options{}))
+	for _, opts := range []parse.Options{
+		{PkgName: "queues"},
+		{Header: "// Code generated by us.\n"},
+		{Strip: "Generic"},
+		{LocalPrefix: "example.com/ourco"},
+		{CTypes: map[string]string{"Something": "int"}},
+		{StripPrefixes: []string{"Generic"}},
+		{FormatOnly: true},
+		{CRLF: true},
+	} {
+		assert.NotEqual(t, hash, parse.InputHashWithOptions([]byte(in), typeSets, opts), "%+v", opts)
+	}
+	out, err = parse.GenericsWithOptions("generic_queue.go", strings.NewReader(in), typeSets, parse.Options{Hash: true, PkgName: "queues"})
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, hash, parse.ReadHash(out))
+		assert.Equal(t, parse.InputHashWithOptions([]byte(in), typeSets, parse.Options{PkgName: "queues"}), parse.ReadHash(out))
+	}
+
+}
+
+func TestGenericsExternalTestPackage(t *testing.T) {
+
+	in := `package queues_test
+
+import (
+	"testing"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Type
+
+func TestItemQueue(t *testing.T) {
+	var items []Item
+	if len(items) != 0 {
+		t.Fail()
+	}
+}
+`
+	out, err := parse.Generics("generic_queue_test.go", "ints", strings.NewReader(in), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "package ints_test\n")
+		assert.Contains(t, string(out), "func TestIntQueue(t *testing.T) {")
+	}
+
+	out, err = parse.Generics("generic_queue_test.go", "", strings.NewReader(in), []map[string]string{{"Item": "int"}}, "")
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), "package queues_test\n")
+	}
+
+}
+
+func TestErrorKinds(t *testing.T) {
+
+	queue := contents(`test/queue/generic_queue.go`)
+	for _, test := range []struct {
+		in       string
+		typeSets []map[string]string
+		kind     error
+	}{
+		{"package", []map[string]string{{"Something": "int"}}, parse.ErrSource},
+		{queue, []map[string]string{{}}, parse.ErrMissingSpecificType},
+		{queue, []map[string]string{{"Other": "int"}}, parse.ErrBadTypeSets},
+		{queue, []map[string]string{{"Something": "int"}, {"Something": "*int"}}, parse.ErrNameCollision},
+		{queue, []map[string]string{{"Something": "int int"}}, parse.ErrImports},
+	} {
+		_, err := parse.Generics("generic_queue.go", "", strings.NewReader(test.in), test.typeSets, "")
+		if assert.Error(t, err) {
+			assert.True(t, errors.Is(err, test.kind), err.Error())
+			assert.False(t, errors.Is(err, parse.ErrBadDirective))
+		}
+	}
+
+	_, err := parse.TypeSet("Item")
+	assert.True(t, errors.Is(err, parse.ErrBadTypeSets))
+
+}
+
+func TestErrorsUnwrap(t *testing.T) {
+
+	_, err := parse.Generics("broken.go", "", strings.NewReader("package broken\n\nfunc {"), nil, "")
+	var list scanner.ErrorList
+	if assert.True(t, errors.As(err, &list)) {
+		assert.Equal(t, "broken.go", list[0].Pos.Filename)
+		assert.Equal(t, 3, list[0].Pos.Line)
+	}
+
+	in := contents(`test/queue/generic_queue.go`)
+	_, err = parse.Generics("generic_queue.go", "", strings.NewReader(in), []map[string]string{{"Something": "int int"}}, "")
+	list = nil
+	if assert.True(t, errors.As(err, &list)) {
+		assert.True(t, list[0].Pos.IsValid())
+	}
+
+	// the code goimports failed on is shown
+	assert.Contains(t, err.Error(), "\n>   12 | type Int intQueue struct {\n")
+
+}
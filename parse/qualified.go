@@ -0,0 +1,128 @@
+package parse
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// importSpec is an import that generated code needs.
+type importSpec struct {
+	Name string
+	Path string
+}
+
+// String gets the import declaration for the spec.
+func (i importSpec) String() string {
+	if i.Name == "" {
+		return "import " + strconv.Quote(i.Path)
+	}
+	return "import " + i.Name + " " + strconv.Quote(i.Path)
+}
+
+// qualifyType finds the packages referred to by their full import path in
+// a specific type, like github.com/google/uuid.UUID or
+// []gopkg.in/yaml.v2.Node, and gets the type as it should be written in
+// code (uuid.UUID and []yaml.Node) along with the imports it needs.
+//
+// Only paths containing a slash are treated as import paths, so types
+// like time.Duration are left for goimports to resolve.
+func qualifyType(specific string) (string, []importSpec) {
+	var imports []importSpec
+	var out strings.Builder
+	for len(specific) > 0 {
+		i := strings.IndexFunc(specific, isPathRune)
+		if i < 0 {
+			out.WriteString(specific)
+			break
+		}
+		out.WriteString(specific[:i])
+		specific = specific[i:]
+		end := strings.IndexFunc(specific, func(r rune) bool { return !isPathRune(r) })
+		if end < 0 {
+			end = len(specific)
+		}
+		word := specific[:end]
+		specific = specific[end:]
+
+		slash := strings.LastIndex(word, "/")
+		dot := strings.LastIndex(word, ".")
+		if slash < 0 || dot < slash {
+			out.WriteString(word)
+			continue
+		}
+		path, typeName := word[:dot], word[dot+1:]
+		spec := importSpec{Path: path, Name: packageName(path)}
+		if spec.Name == path[strings.LastIndex(path, "/")+1:] {
+			spec.Name = ""
+			out.WriteString(path[slash+1:] + "." + typeName)
+		} else {
+			out.WriteString(spec.Name + "." + typeName)
+		}
+		imports = append(imports, spec)
+	}
+	return out.String(), imports
+}
+
+// isPathRune gets whether the rune can be part of a qualified type name.
+func isPathRune(r rune) bool {
+	return isAlphaNumeric(r) || strings.ContainsRune("./-~", r)
+}
+
+// packageName guesses the name of the package at the import path, the
+// same way goimports does: major version elements (like v2) and
+// gopkg.in style suffixes are ignored, as are go- prefixes and -go
+// suffixes.
+func packageName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "go-")
+	name = strings.TrimSuffix(name, "-go")
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// isMajorVersion gets whether the path element is a major version, like
+// v2.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(elem[1:])
+	return err == nil
+}
+
+// qualifyTypeSets resolves the fully qualified specific types in each of
+// the type sets, giving new type sets along with every import they need
+// sorted by path.
+func qualifyTypeSets(typeSets []map[string]string) ([]map[string]string, []importSpec) {
+	resolved := make([]map[string]string, len(typeSets))
+	seen := make(map[string]importSpec)
+	for i, typeSet := range typeSets {
+		resolved[i] = make(map[string]string, len(typeSet))
+		for k, v := range typeSet {
+			specific, imports := qualifyType(v)
+			resolved[i][k] = specific
+			for _, imp := range imports {
+				seen[imp.Path] = imp
+			}
+		}
+	}
+	var imports []importSpec
+	for _, imp := range seen {
+		imports = append(imports, imp)
+	}
+	sort.Slice(imports, func(i, j int) bool { return imports[i].Path < imports[j].Path })
+	return resolved, imports
+}
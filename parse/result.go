@@ -0,0 +1,135 @@
+package parse
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// GenericsResult describes the code generated by GenericsWithResult.
+type GenericsResult struct {
+	// Code is the generated code.
+	Code []byte
+	// Generics are the names of the generic types declared in the source,
+	// in the order they are declared.
+	Generics []string
+	// TypeSets are the specific types that were substituted for the
+	// generic types, one map for each copy of the code.
+	TypeSets []map[string]string
+	// NeedC is whether import "C" was added to the code for C types.
+	NeedC bool
+	// Package is the name of the package of the generated code.
+	Package string
+	// Decls is the number of top-level declarations (other than imports)
+	// in the generated code.
+	Decls int
+	// Names are the names of the top-level declarations in the generated
+	// code, in order. Methods are named after their receiver type, like
+	// *IntQueue.Push.
+	Names []string
+	// Duplicates are the names of the declarations that were dropped
+	// because an earlier type set generated exactly the same code.
+	Duplicates []string
+	// Imports are the import paths of the generated code, sorted.
+	Imports []string
+	// AddedImports are the imports of the generated code that the source
+	// doesn't have, like the packages of specific types.
+	AddedImports []string
+	// RemovedImports are the imports of the source, other than the
+	// generic packages, that the generated code doesn't need.
+	RemovedImports []string
+	// Unused are the generic types of each of the type sets (in the same
+	// order as TypeSets) that were never replaced, because the source
+	// only declares them, sorted.
+	Unused [][]string
+}
+
+// GenericsWithResult parses the source file and generates the bytes
+// replacing the generic types for the keys map with the specific types
+// (its value), the same as GenericsWithOptions, and describes what was
+// generated.
+func GenericsWithResult(filename string, in io.ReadSeeker, typeSets []map[string]string, opts Options) (*GenericsResult, error) {
+	return generics(context.Background(), filename, in, typeSets, opts)
+}
+
+// importPaths gets the sorted import paths of the file, leaving out any
+// in skip.
+func importPaths(file *ast.File, skip ...string) []string {
+	var paths []string
+	for _, imp := range file.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || containsString(skip, path) || containsString(paths, path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// diffImports gets the imports in a that aren't in b.
+func diffImports(a, b []string) []string {
+	var diff []string
+	for _, path := range a {
+		if !containsString(b, path) {
+			diff = append(diff, path)
+		}
+	}
+	return diff
+}
+
+// countDecls counts the top-level declarations in the source, not
+// counting imports.
+func countDecls(filename string, src []byte) int {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// declNames gets the package name of the source and the names of its
+// top-level declarations (other than imports), in order.
+func declNames(filename string, src []byte) (string, []string) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, src, 0)
+	if err != nil {
+		return "", nil
+	}
+	var names []string
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = types.ExprString(d.Recv.List[0].Type) + "." + name
+			}
+			names = append(names, name)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, s.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if name.Name != "_" {
+							names = append(names, name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return file.Name.Name, names
+}
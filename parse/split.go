@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// DefaultOutputPattern is the pattern used to name the file generated for
+// each type set by GenericsSplit.
+const DefaultOutputPattern = "{{.Base}}_{{.Type}}.go"
+
+// outputName holds the values available to output patterns.
+type outputName struct {
+	// Base is the name of the source file without its directory or
+	// extension.
+	Base string
+	// Type is the name of every specific type in the type set, ordered by
+	// the generic type they replace and separated by underscores.
+	Type string
+	// Types is the name of each specific type keyed by the generic type
+	// it replaces.
+	Types map[string]string
+}
+
+// OutputFilename gets the name of the file to generate for the type set
+// from the source filename and the pattern, which is a text/template that
+// can use {{.Base}}, {{.Type}} and {{.Types.GenericType}}.
+//
+//     OutputFilename("{{.Base}}_{{.Type}}.go", "container.go", map[string]string{"Item": "int"})
+//
+// gives container_int.go. Code generated from a test file is put in a
+// test file too, so container_test.go gives container_int_test.go.
+func OutputFilename(pattern, filename string, typeSet map[string]string) (string, error) {
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	test := strings.HasSuffix(filename, testFileSuffix)
+	name := outputName{
+		Base:  strings.TrimSuffix(base, testPackageSuffix),
+		Types: make(map[string]string, len(typeSet)),
+	}
+	var keys []string
+	for k, v := range typeSet {
+		keys = append(keys, k)
+		name.Types[k] = strings.ToLower(wordify(v, false))
+	}
+	sort.Strings(keys)
+	var types []string
+	for _, k := range keys {
+		types = append(types, name.Types[k])
+	}
+	name.Type = strings.Join(types, "_")
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, name); err != nil {
+		return "", err
+	}
+	output := buf.String()
+	if test && strings.HasSuffix(output, ".go") && !strings.HasSuffix(output, testFileSuffix) {
+		output = strings.TrimSuffix(output, ".go") + testFileSuffix
+	}
+	return output, nil
+}
+
+// GenericsSplit parses the source file and generates a separate file for
+// each of the type sets, rather than putting them all in one. The files
+// are keyed by their name, which comes from DefaultOutputPattern.
+//
+// Each file has its own header, package clause and imports.
+func GenericsSplit(filename, pkgName string, in io.ReadSeeker, typeSets []map[string]string, strip string) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(typeSets))
+	for _, typeSet := range typeSets {
+		name, err := OutputFilename(DefaultOutputPattern, filename, typeSet)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := files[name]; ok {
+			return nil, &errDuplicateOutput{Filename: name}
+		}
+		output, err := Generics(filename, pkgName, in, []map[string]string{typeSet}, strip)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = output
+	}
+	return files, nil
+}
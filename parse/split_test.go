@@ -0,0 +1,57 @@
+package parse_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joelrahman/genny/parse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputFilename(t *testing.T) {
+
+	for _, test := range []struct {
+		pattern  string
+		filename string
+		typeSet  map[string]string
+		expected string
+	}{
+		{parse.DefaultOutputPattern, "container.go", map[string]string{"Item": "int"}, "container_int.go"},
+		{parse.DefaultOutputPattern, "path/to/container.go", map[string]string{"Item": "*MyType"}, "container_mytype.go"},
+		{parse.DefaultOutputPattern, "simplemap.go", map[string]string{"ValueType": "int", "KeyType": "string"}, "simplemap_string_int.go"},
+		{"{{.Types.ValueType}}_{{.Base}}.go", "simplemap.go", map[string]string{"ValueType": "[]byte", "KeyType": "string"}, "byteslice_simplemap.go"},
+		{parse.DefaultOutputPattern, "container_test.go", map[string]string{"Item": "int"}, "container_int_test.go"},
+		{"{{.Type}}_test.go", "container_test.go", map[string]string{"Item": "int"}, "int_test.go"},
+	} {
+		name, err := parse.OutputFilename(test.pattern, test.filename, test.typeSet)
+		if assert.NoError(t, err) {
+			assert.Equal(t, test.expected, name)
+		}
+	}
+
+	_, err := parse.OutputFilename("{{.Types.Missing}}.go", "container.go", map[string]string{"Item": "int"})
+	assert.Error(t, err)
+
+}
+
+func TestGenericsSplit(t *testing.T) {
+
+	in := contents(`test/queue/generic_queue.go`)
+	files, err := parse.GenericsSplit("generic_queue.go", "", strings.NewReader(in), []map[string]string{
+		{"Something": "int"},
+		{"Something": "float32"},
+	}, "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string][]byte{
+			"generic_queue_int.go":     []byte(contents(`test/queue/int_queue.go`)),
+			"generic_queue_float32.go": []byte(contents(`test/queue/float32_queue.go`)),
+		}, files)
+	}
+
+	_, err = parse.GenericsSplit("generic_queue.go", "", strings.NewReader(in), []map[string]string{
+		{"Something": "int"},
+		{"Something": "*int"},
+	}, "")
+	assert.EqualError(t, err, "More than one type set would be generated into 'generic_queue_int.go'")
+
+}
@@ -0,0 +1,14 @@
+package alias
+
+import gen "github.com/joelrahman/genny/generic"
+
+type Something gen.Type
+
+// SomethingQueue is a queue of Somethings.
+type SomethingQueue struct {
+	items []Something
+}
+
+func NewSomethingQueue() *SomethingQueue {
+	return &SomethingQueue{items: make([]Something, 0)}
+}
@@ -0,0 +1,13 @@
+//go:build !purego
+// +build !purego
+
+package buildtags
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// ItemBox holds an Item.
+type ItemBox struct {
+	Value Item
+}
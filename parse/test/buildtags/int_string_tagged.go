@@ -0,0 +1,18 @@
+//go:build !purego
+// +build !purego
+
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package buildtags
+
+// IntBox holds an int.
+type IntBox struct {
+	Value int
+}
+
+// StringBox holds an string.
+type StringBox struct {
+	Value string
+}
@@ -0,0 +1,25 @@
+package comments
+
+import "github.com/joelrahman/genny/generic"
+
+/*
+Something is the type held in the box,
+it is dropped along with its declaration.
+*/
+type Something generic.Type
+
+/*
+SomethingBox holds a single Something.
+
+Unlike a generic.Type, a SomethingBox
+is a real type.
+*/
+type SomethingBox struct {
+	value Something /* the Something */
+}
+
+/* Put puts a Something in the box. */
+func (b *SomethingBox) Put(v Something) {
+	b.value = v /* replaces any
+	old Something */
+}
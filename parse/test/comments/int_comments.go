@@ -0,0 +1,21 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package comments
+
+/*
+IntBox holds a single int.
+
+Unlike a generic.Type, a IntBox
+is a real type.
+*/
+type IntBox struct {
+	value int /* the int */
+}
+
+/* Put puts a int in the box. */
+func (b *IntBox) Put(v int) {
+	b.value = v /* replaces any
+	old int */
+}
@@ -0,0 +1,48 @@
+package conditional
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type Item generic.Ordered
+
+// ItemSet is a set of Items.
+type ItemSet map[Item]struct{}
+
+//genny:if Ordered
+// Max gets the largest Item in the set.
+func (s ItemSet) Max() Item {
+	var max Item
+	for v := range s {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+//genny:if Item Number
+// Sum adds up the Items in the set.
+func (s ItemSet) Sum() Item {
+	var total Item
+	for v := range s {
+		total += v
+	}
+	return total
+}
+//genny:endif
+//genny:endif
+
+//genny:if String
+// Join joins the Items in the set with the separator.
+func (s ItemSet) Join(sep string) string {
+	var parts []string
+	for v := range s {
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, sep)
+}
+//genny:endif
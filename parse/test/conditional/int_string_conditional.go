@@ -0,0 +1,56 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package conditional
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IntSet is a set of Ints.
+type IntSet map[int]struct{}
+
+// Max gets the largest int in the set.
+func (s IntSet) Max() int {
+	var max int
+	for v := range s {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Sum adds up the Ints in the set.
+func (s IntSet) Sum() int {
+	var total int
+	for v := range s {
+		total += v
+	}
+	return total
+}
+
+// StringSet is a set of Strings.
+type StringSet map[string]struct{}
+
+// Max gets the largest string in the set.
+func (s StringSet) Max() string {
+	var max string
+	for v := range s {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// Join joins the Strings in the set with the separator.
+func (s StringSet) Join(sep string) string {
+	var parts []string
+	for v := range s {
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,15 @@
+//go:build cgo
+// +build cgo
+
+package ctypes
+
+import (
+	"github.com/joelrahman/genny/generic"
+	"github.com/joelrahman/genny/generic/cgeneric"
+)
+
+type Item generic.Type
+type CItem cgeneric.CType
+
+// ItemToC converts an Item to its C type.
+func ItemToC(v Item) CItem { return CItem(v) }
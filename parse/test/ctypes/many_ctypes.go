@@ -0,0 +1,31 @@
+//go:build cgo
+// +build cgo
+
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package ctypes
+
+import "C"
+
+// BoolToC converts an bool to its C type.
+func BoolToC(v bool) C._Bool { return C._Bool(v) }
+
+// ByteToC converts an byte to its C type.
+func ByteToC(v byte) C.uchar { return C.uchar(v) }
+
+// Uint8ToC converts an uint8 to its C type.
+func Uint8ToC(v uint8) C.uchar { return C.uchar(v) }
+
+// Int8ToC converts an int8 to its C type.
+func Int8ToC(v int8) C.schar { return C.schar(v) }
+
+// Int16ToC converts an int16 to its C type.
+func Int16ToC(v int16) C.short { return C.short(v) }
+
+// Uint16ToC converts an uint16 to its C type.
+func Uint16ToC(v uint16) C.ushort { return C.ushort(v) }
+
+// UintptrToC converts an uintptr to its C type.
+func UintptrToC(v uintptr) C.size_t { return C.size_t(v) }
@@ -0,0 +1,21 @@
+package dedupe
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// defaultCapacity is shared by every list.
+const defaultCapacity = 8
+
+// ItemList is a list of Items.
+type ItemList []Item
+
+// NewItemList makes an empty ItemList.
+func NewItemList() ItemList {
+	return make(ItemList, 0, capacity())
+}
+
+// capacity gets the starting capacity of a list.
+func capacity() int {
+	return defaultCapacity
+}
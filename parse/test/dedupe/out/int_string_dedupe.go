@@ -0,0 +1,29 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package dedupe
+
+// defaultCapacity is shared by every list.
+const defaultCapacity = 8
+
+// IntList is a list of Ints.
+type IntList []int
+
+// NewIntList makes an empty IntList.
+func NewIntList() IntList {
+	return make(IntList, 0, capacity())
+}
+
+// capacity gets the starting capacity of a list.
+func capacity() int {
+	return defaultCapacity
+}
+
+// StringList is a list of Strings.
+type StringList []string
+
+// NewStringList makes an empty StringList.
+func NewStringList() StringList {
+	return make(StringList, 0, capacity())
+}
@@ -0,0 +1,16 @@
+// Copyright 2019 The Genny Authors.
+//
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package license shows that leading comments are only kept once.
+package license
+
+import "github.com/joelrahman/genny/generic"
+
+type Item generic.Type
+
+// ItemBox holds an Item.
+type ItemBox struct {
+	Value Item
+}
@@ -0,0 +1,21 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+// Copyright 2019 The Genny Authors.
+//
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package license shows that leading comments are only kept once.
+package license
+
+// IntBox holds an int.
+type IntBox struct {
+	Value int
+}
+
+// StringBox holds an string.
+type StringBox struct {
+	Value string
+}
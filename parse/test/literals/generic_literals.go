@@ -0,0 +1,21 @@
+package literals
+
+import (
+	"fmt"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type ValueType generic.Type
+
+const ValueTypeMsg = "ValueType"
+
+const ValueTypeUsage = `ValueTypeList holds
+many ValueType values`
+
+// ValueTypeList is a list of ValueType values.
+type ValueTypeList []ValueType
+
+func (l ValueTypeList) String() string {
+	return fmt.Sprintf("ValueType=%v %c", []ValueType(l), 'V')
+}
@@ -0,0 +1,21 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package literals
+
+import (
+	"fmt"
+)
+
+const ValueTypeMsg = "ValueType"
+
+const ValueTypeUsage = `ValueTypeList holds
+many ValueType values`
+
+// IntList is a list of int values.
+type IntList []int
+
+func (l IntList) String() string {
+	return fmt.Sprintf("ValueType=%v %c", []int(l), 'V')
+}
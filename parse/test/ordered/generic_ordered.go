@@ -0,0 +1,16 @@
+package ordered
+
+import "github.com/joelrahman/genny/generic"
+
+type Key generic.Ordered
+
+// MinKey gets the smallest of the Keys.
+func MinKey(keys ...Key) Key {
+	min := keys[0]
+	for _, k := range keys[1:] {
+		if k < min {
+			min = k
+		}
+	}
+	return min
+}
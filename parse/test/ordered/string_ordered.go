@@ -0,0 +1,16 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package ordered
+
+// MinString gets the smallest of the Strings.
+func MinString(keys ...string) string {
+	min := keys[0]
+	for _, k := range keys[1:] {
+		if k < min {
+			min = k
+		}
+	}
+	return min
+}
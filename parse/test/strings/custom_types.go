@@ -0,0 +1,3 @@
+package strings
+
+type Name string
@@ -0,0 +1,13 @@
+package strings
+
+import "github.com/joelrahman/genny/generic"
+
+type Text generic.String
+
+// JoinText joins two Texts with a separator.
+func JoinText(a, b, sep Text) Text {
+	if len(a) == 0 {
+		return b
+	}
+	return a + sep + b
+}
@@ -0,0 +1,13 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package strings
+
+// JoinName joins two Names with a separator.
+func JoinName(a, b, sep Name) Name {
+	if len(a) == 0 {
+		return b
+	}
+	return a + sep + b
+}
@@ -0,0 +1,3 @@
+package unexportedmethods
+
+type myType struct{}
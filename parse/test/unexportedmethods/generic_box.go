@@ -0,0 +1,37 @@
+package unexportedmethods
+
+import (
+	"fmt"
+
+	"github.com/joelrahman/genny/generic"
+)
+
+type secret generic.Type
+
+// secretBox holds a secret.
+type secretBox struct {
+	secret  secret
+	secrets []secret
+}
+
+// newSecretBox makes a secretBox.
+func newSecretBox(s secret) *secretBox {
+	return &secretBox{secret: s}
+}
+
+// NewSecretBox makes a secretBox for other packages.
+func NewSecretBox(s secret) *secretBox {
+	return newSecretBox(s)
+}
+
+func (b *secretBox) getSecret() secret {
+	return b.secret
+}
+
+func (b *secretBox) SecretString() string {
+	return fmt.Sprint(b.secret)
+}
+
+func (b *secretBox) addSecrets(secrets ...secret) {
+	b.secrets = append(b.secrets, secrets...)
+}
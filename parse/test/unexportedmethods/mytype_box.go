@@ -0,0 +1,37 @@
+// This file was automatically generated by genny.
+// Any changes will be lost if this file is regenerated.
+// see https://github.com/joelrahman/genny
+
+package unexportedmethods
+
+import (
+	"fmt"
+)
+
+// myTypeBox holds a *myType.
+type myTypeBox struct {
+	myType  *myType
+	myTypes []*myType
+}
+
+// newMyTypeBox makes a myTypeBox.
+func newMyTypeBox(s *myType) *myTypeBox {
+	return &myTypeBox{myType: s}
+}
+
+// NewMyTypeBox makes a myTypeBox for other packages.
+func NewMyTypeBox(s *myType) *myTypeBox {
+	return newMyTypeBox(s)
+}
+
+func (b *myTypeBox) getMyType() *myType {
+	return b.myType
+}
+
+func (b *myTypeBox) MyTypeString() string {
+	return fmt.Sprint(b.myType)
+}
+
+func (b *myTypeBox) addMyTypes(myTypes ...*myType) {
+	b.myTypes = append(b.myTypes, myTypes...)
+}
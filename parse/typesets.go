@@ -1,6 +1,9 @@
 package parse
 
-import "strings"
+import (
+	"sort"
+	"strings"
+)
 
 const (
 	typeSep     = " "
@@ -32,7 +35,7 @@ func TypeSet(arg string) ([]map[string]string, error) {
 		key := segs[0]
 		keys = append(keys, key)
 		types[key] = make([]string, 0)
-		for _, t := range strings.Split(segs[1], valuesSep) {
+		for _, t := range splitTypes(segs[1]) {
 			if t == builtins {
 				types[key] = append(types[key], Builtins...)
 			} else if t == numbers {
@@ -43,6 +46,55 @@ func TypeSet(arg string) ([]map[string]string, error) {
 		}
 	}
 
+	return product(keys, types), nil
+
+}
+
+// splitTypes splits a comma separated list of specific types, leaving the
+// commas between brackets (like those of Pair[string,int]) alone.
+func splitTypes(s string) []string {
+	var types []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch {
+		case r == '[' || r == '(':
+			depth++
+		case r == ']' || r == ')':
+			depth--
+		case depth == 0 && string(r) == valuesSep:
+			types = append(types, s[start:i])
+			start = i + len(valuesSep)
+		}
+	}
+	return append(types, s[start:])
+}
+
+// Product turns a map of generic types to the specific types each should
+// be generated for into a []map[string]string holding every combination
+// of them, ready to be given to parse.Generics.
+//
+// For example:
+//
+//     {"KeyType": {"string", "int"}, "ValueType": {"int", "bool"}}
+//
+// gives four type sets, one for each key and value type pairing.
+// Combinations are ordered by the generic type names.
+func Product(types map[string][]string) []map[string]string {
+	keys := make([]string, 0, len(types))
+	for key := range types {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return product(keys, types)
+}
+
+// product builds every combination of the types, varying the last of the
+// keys fastest.
+func product(keys []string, types map[string][]string) []map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+
 	cursors := make(map[string]int)
 	for _, key := range keys {
 		cursors[key] = 0
@@ -59,8 +111,7 @@ func TypeSet(arg string) ([]map[string]string, error) {
 		typeSets = append(typeSets, typeSet)
 	}
 
-	return typeSets, nil
-
+	return typeSets
 }
 
 func buildTypeSet(keys []string, keyI int, cursors map[string]int, types map[string][]string, out chan<- map[string]string) {
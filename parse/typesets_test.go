@@ -1,6 +1,7 @@
 package parse_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/joelrahman/genny/parse"
@@ -71,4 +72,68 @@ func TestArgsToTypeset(t *testing.T) {
 		assert.Equal(t, ts[0]["Place"], "interface{}")
 	}
 
+	ts, err = parse.TypeSet("Key=string,Pair[string,int] Value=func(int,string)")
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(ts)) {
+		assert.Equal(t, "Pair[string,int]", ts[1]["Key"])
+		assert.Equal(t, "func(int,string)", ts[1]["Value"])
+	}
+
+}
+
+func TestProduct(t *testing.T) {
+
+	ts := parse.Product(map[string][]string{
+		"ValueType": {"int", "bool"},
+		"KeyType":   {"string", "int"},
+	})
+
+	assert.Equal(t, []map[string]string{
+		{"KeyType": "string", "ValueType": "int"},
+		{"KeyType": "string", "ValueType": "bool"},
+		{"KeyType": "int", "ValueType": "int"},
+		{"KeyType": "int", "ValueType": "bool"},
+	}, ts)
+
+	assert.Empty(t, parse.Product(nil))
+
+}
+
+func TestReadTypeSets(t *testing.T) {
+
+	expected := []map[string]string{
+		{"KeyType": "string", "ValueType": "map[string]int"},
+		{"KeyType": "int", "ValueType": "[]byte"},
+	}
+
+	typeSets, err := parse.ReadTypeSets("types.json", strings.NewReader(`[
+		{"KeyType": "string", "ValueType": "map[string]int"},
+		{"KeyType": "int", "ValueType": "[]byte"}
+	]`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, typeSets)
+	}
+
+	typeSets, err = parse.ReadTypeSets("types.yaml", strings.NewReader(`
+- KeyType: string
+  ValueType: map[string]int
+- KeyType: int
+  ValueType: "[]byte"
+`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected, typeSets)
+	}
+
+	_, err = parse.ReadTypeSets("types.json", strings.NewReader(`[{"KeyType": "int"}, {"KeyType": "func("}]`))
+	if assert.Error(t, err) {
+		assert.Equal(t, `"types.json" is bad: type set 1: "func(" is not a type for KeyType`, err.Error())
+	}
+
+	_, err = parse.ReadTypeSets("types.json", strings.NewReader(`[{"KeyType": "int"}, {}]`))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "type set 1")
+	}
+
+	_, err = parse.ReadTypeSets("types.json", strings.NewReader(`{"KeyType": "int"}`))
+	assert.Error(t, err)
+
 }
@@ -0,0 +1,69 @@
+package parse
+
+import (
+	"encoding/json"
+	"go/parser"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ReadTypeSets reads type sets from a JSON or YAML file (depending on the
+// extension of the filename, which is JSON unless it ends in .yaml or
+// .yml). The file holds an array with a map of generic types to specific
+// types for each type set:
+//
+//     [
+//       {"KeyType": "string", "ValueType": "map[string]int"},
+//       {"KeyType": "int", "ValueType": "[]byte"}
+//     ]
+//
+// Unlike TypeSet, every combination has to be given and the specific
+// types are used exactly as they are written.
+func ReadTypeSets(filename string, r io.Reader) ([]map[string]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var typeSets []map[string]string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &typeSets)
+	default:
+		err = json.Unmarshal(b, &typeSets)
+	}
+	if err != nil {
+		return nil, &errBadTypeSetsFile{Filename: filename, Index: -1, Message: err.Error()}
+	}
+
+	for i, typeSet := range typeSets {
+		if len(typeSet) == 0 {
+			return nil, &errBadTypeSetsFile{Filename: filename, Index: i, Message: "no types were given"}
+		}
+		for generic, specific := range typeSet {
+			if !isIdentifier(generic) {
+				return nil, &errBadTypeSetsFile{Filename: filename, Index: i, Message: strconv.Quote(generic) + " is not a generic type name"}
+			}
+			if _, err := parser.ParseExpr(specific); err != nil {
+				return nil, &errBadTypeSetsFile{Filename: filename, Index: i, Message: strconv.Quote(specific) + " is not a type for " + generic}
+			}
+		}
+	}
+	return typeSets, nil
+}
+
+// isIdentifier gets whether s is a valid Go identifier.
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if !isAlphaNumeric(r) || i == 0 && unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
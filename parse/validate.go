@@ -0,0 +1,176 @@
+package parse
+
+import (
+	"go/ast"
+	"go/token"
+	"io"
+)
+
+// genericKinds are the placeholder types of each generic package.
+var genericKinds = map[string][]string{
+	genericPackage:  {"Type", "Number", "String", "Ordered", "Size"},
+	cgenericPackage: {"CType", "CNumber"},
+}
+
+// Validate checks that the source file is a template genny can use,
+// without generating any code. It gets the names of the generic types the
+// source declares, in the order they are declared, and an error listing
+// every other reference to the generic packages (like a variable of type
+// generic.Type, or a generic.Typo that doesn't exist).
+func Validate(filename string, in io.ReadSeeker) ([]string, error) {
+
+	src, err := parseSource(filename, in, Options{})
+	if err != nil {
+		return nil, err
+	}
+	kinds := map[string][]string{
+		src.genericName:  genericKinds[genericPackage],
+		src.cgenericName: genericKinds[cgenericPackage],
+	}
+
+	// find the generic type declarations
+	var names []string
+	var undeclared []errUndeclaredGeneric
+	declarations := make(map[*ast.SelectorExpr]bool)
+	for _, d := range src.decls {
+		declarations[d.sel] = true
+		names = append(names, d.Name)
+	}
+
+	// find the zero values, like Item(generic.Zero)
+	zeros := make(map[*ast.SelectorExpr]bool)
+	ast.Inspect(src.file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		fun, ok := call.Fun.(*ast.Ident)
+		if !ok || !containsString(names, fun.Name) {
+			return true
+		}
+		if sel, ok := call.Args[0].(*ast.SelectorExpr); ok {
+			zeros[sel] = true
+		}
+		return true
+	})
+
+	// check every reference to the generic packages
+	ast.Inspect(src.file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Obj != nil || kinds[x.Name] == nil {
+			return true
+		}
+		ref := x.Name + "." + sel.Sel.Name
+		switch {
+		case x.Name == src.genericName && sel.Sel.Name == "Zero":
+			if !zeros[sel] {
+				undeclared = append(undeclared, errUndeclaredGeneric{Reference: ref, Reason: "is only the zero value of a generic type, like Item(" + ref + ")", Position: src.fs.Position(sel.Pos())})
+			}
+		case !containsString(kinds[x.Name], sel.Sel.Name):
+			undeclared = append(undeclared, errUndeclaredGeneric{Reference: ref, Reason: "is not a generic type", Position: src.fs.Position(sel.Pos())})
+		case !declarations[sel]:
+			undeclared = append(undeclared, errUndeclaredGeneric{Reference: ref, Reason: "is used outside of a generic type declaration", Position: src.fs.Position(sel.Pos())})
+		}
+		return true
+	})
+
+	if len(undeclared) > 0 {
+		return names, &errUndeclaredGenerics{References: undeclared}
+	}
+	return names, nil
+}
+
+// GenericParam is a generic type declared in a template.
+type GenericParam struct {
+	// Name is the name of the generic type, like Item.
+	Name string
+	// Kind is the placeholder type it is declared as, like Type, Number,
+	// CType or CNumber (or Size for the constant generic.Size).
+	Kind string
+}
+
+// GenericTypes parses the source file and gets the generic types it
+// declares, in the order they are declared.
+func GenericTypes(filename string, in io.ReadSeeker) ([]GenericParam, error) {
+	return GenericTypesWithOptions(filename, in, Options{})
+}
+
+// GenericTypesWithOptions is like GenericTypes for a source that uses the
+// generic package of the options (see GenericImportPath).
+func GenericTypesWithOptions(filename string, in io.ReadSeeker, opts Options) ([]GenericParam, error) {
+	src, err := parseSource(filename, in, opts)
+	if err != nil {
+		return nil, err
+	}
+	var params []GenericParam
+	for _, d := range src.decls {
+		params = append(params, d.GenericParam)
+	}
+	return params, nil
+}
+
+// genericDecl is the declaration of a generic type, or of a generic
+// constant (like const Length = generic.Size).
+type genericDecl struct {
+	GenericParam
+	// pkg is what the generic package is called in the file.
+	pkg string
+	// spec is the *ast.TypeSpec or *ast.ValueSpec of the declaration.
+	spec ast.Spec
+	// sel is the reference to the placeholder, like generic.Type.
+	sel *ast.SelectorExpr
+}
+
+// genericDecls finds the declarations of generic types (like type Item
+// generic.Type) and constants among the top-level declarations of the
+// file.
+func genericDecls(file *ast.File, genericName, cgenericName string) []genericDecl {
+	var decls []genericDecl
+	add := func(spec ast.Spec, name *ast.Ident, expr ast.Expr) {
+		sel, ok := expr.(*ast.SelectorExpr)
+		if !ok {
+			return
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Name != genericName && x.Name != cgenericName {
+			return
+		}
+		decls = append(decls, genericDecl{
+			GenericParam: GenericParam{Name: name.Name, Kind: sel.Sel.Name},
+			pkg:          x.Name,
+			spec:         spec,
+			sel:          sel,
+		})
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				add(s, s.Name, s.Type)
+			case *ast.ValueSpec:
+				if gen.Tok == token.CONST && len(s.Names) == 1 && len(s.Values) == 1 && s.Type == nil {
+					add(s, s.Names[0], s.Values[0])
+				}
+			}
+		}
+	}
+	return decls
+}
+
+// containsString gets whether the strings include s.
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/joelrahman/genny/parse"
+)
+
+// fileReport is what -report says about a generated file.
+type fileReport struct {
+	In           string              `json:"in"`
+	Out          string              `json:"out,omitempty"`
+	Package      string              `json:"package"`
+	TypeSets     []map[string]string `json:"typeSets"`
+	Symbols      []string            `json:"symbols"`
+	Imports      []string            `json:"imports"`
+	AddedImports []string            `json:"addedImports"`
+	Cgo          bool                `json:"cgo"`
+}
+
+// reporter collects the reports of the generated files, for -report.
+type reporter struct {
+	files []fileReport
+}
+
+// add adds the report of the code generated from the file to out (which
+// is empty for stdout).
+func (r *reporter) add(filename, out string, res *parse.GenericsResult) {
+	r.files = append(r.files, fileReport{
+		In:           filename,
+		Out:          out,
+		Package:      res.Package,
+		TypeSets:     res.TypeSets,
+		Symbols:      res.Names,
+		Imports:      res.Imports,
+		AddedImports: res.AddedImports,
+		Cgo:          res.NeedC,
+	})
+}
+
+// save saves the reports to the file as a JSON array, in the order the
+// files were generated.
+func (r *reporter) save(name string) error {
+	files := r.files
+	if files == nil {
+		files = []fileReport{}
+	}
+	b, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, append(b, '\n'), 0644)
+}